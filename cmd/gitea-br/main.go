@@ -0,0 +1,13 @@
+// Command gitea-br backs up and restores a Gitea instance. Run
+// "gitea-br help" for its commands.
+package main
+
+import (
+	"os"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/cli"
+)
+
+func main() {
+	os.Exit(cli.Main(os.Args[1:]))
+}
@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/database"
+	"github.com/Frantche/gitea-backup-restore-process/internal/encryption"
+	"github.com/Frantche/gitea-backup-restore-process/internal/files"
+	"github.com/Frantche/gitea-backup-restore-process/internal/history"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+	"github.com/Frantche/gitea-backup-restore-process/internal/signing"
+	"github.com/Frantche/gitea-backup-restore-process/internal/storage"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+func backupCommand() *command {
+	return &command{
+		Name:        "backup",
+		Summary:     "back up the Gitea database and data to remote storage",
+		Description: "Dumps the database, archives it with the repositories and avatars, and\nuploads the archive, then applies the retention policy.",
+		Run:         backup,
+	}
+}
+
+func backup(settings *config.Settings, stdout io.Writer) error {
+	logger.Info("Starting backup process")
+
+	// Read Gitea configuration
+	giteaConfig, err := config.ReadGiteaConfig(settings.AppIniPath)
+	if err != nil {
+		return fmt.Errorf("failed to read Gitea configuration: %w", err)
+	}
+
+	logger.Debugf("Gitea config: %+v", giteaConfig)
+
+	if err := runBackup(settings, giteaConfig); err != nil {
+		return err
+	}
+
+	logger.Info("Backup process completed successfully")
+	return nil
+}
+
+func runBackup(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	// Load the signing key before doing any work
+	signer, err := newSigner(settings)
+	if err != nil {
+		return err
+	}
+
+	if settings.BackupStreaming {
+		// Write the archive straight to remote storage
+		if err := runStage("stream_backup", func() error { return streamBackup(settings, giteaConfig, signer) }); err != nil {
+			return err
+		}
+	} else if err := stageBackup(settings, giteaConfig, signer); err != nil {
+		return err
+	}
+
+	// Upload the signature next to the archive
+	if signer != nil {
+		if err := uploadSignature(settings, signer); err != nil {
+			return err
+		}
+	}
+
+	// Enforce retention policy
+	if err := runStage("retention", func() error { return storage.EnsureMaxRetention(settings) }); err != nil {
+		return fmt.Errorf("retention policy enforcement failed: %w", err)
+	}
+
+	// Add to history
+	if err := history.Increment(settings, settings.BackupTmpRemoteFilename); err != nil {
+		return fmt.Errorf("failed to update backup history: %w", err)
+	}
+
+	return nil
+}
+
+// stageBackup copies the database dump and files to the backup tmp folder,
+// archives them to the backup tmp file and uploads it. The archive is
+// written to signer, if not nil.
+func stageBackup(settings *config.Settings, giteaConfig *config.GiteaConfig, signer *signing.Signer) error {
+	// Clean temporary directories
+	if err := files.CleanTmp(settings); err != nil {
+		return fmt.Errorf("failed to clean temporary directories: %w", err)
+	}
+
+	// Backup database
+	if err := runStage("database_backup", func() error { return database.BackupDatabase(settings, giteaConfig) }); err != nil {
+		return fmt.Errorf("database backup failed: %w", err)
+	}
+
+	// Backup files
+	if err := runStage("files_backup", func() error { return files.BackupFiles(settings, giteaConfig) }); err != nil {
+		return fmt.Errorf("file backup failed: %w", err)
+	}
+
+	backupManifest, err := newManifest(settings, giteaConfig)
+	if err != nil {
+		return err
+	}
+
+	// Create backup archive
+	if err := runStage("archive", func() error { return compression.CreateZip(settings, backupManifest) }); err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	// Encrypt backup archive
+	if encryption.Enabled(settings) {
+		if err := encryption.EncryptFile(settings); err != nil {
+			return err
+		}
+	}
+
+	// Sign backup archive
+	if signer != nil {
+		if err := hashFile(signer, settings.BackupTmpFilename); err != nil {
+			return fmt.Errorf("failed to sign archive: %w", err)
+		}
+	}
+
+	// Upload to remote storage
+	if err := runStage("upload", func() error { return storage.Upload(settings) }); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+
+	return nil
+}
+
+// streamBackup writes the database dump and files into an archive that is
+// uploaded while it is being produced, without touching the local disk. The
+// archive is also written to signer, if not nil.
+func streamBackup(settings *config.Settings, giteaConfig *config.GiteaConfig, signer *signing.Signer) error {
+	pr, pw := io.Pipe()
+	var w io.Writer = pw
+	if signer != nil {
+		w = io.MultiWriter(pw, signer)
+	}
+	archiveErr := make(chan error, 1)
+	go func() {
+		err := writeArchive(w, settings, giteaConfig)
+		pw.CloseWithError(err)
+		archiveErr <- err
+	}()
+
+	uploadErr := storage.UploadStream(settings, settings.BackupTmpRemoteFilename, pr, -1)
+	if uploadErr != nil {
+		// Unblock the archive writer if the upload stopped reading
+		pr.CloseWithError(uploadErr)
+	}
+
+	if err := <-archiveErr; err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	if uploadErr != nil {
+		return fmt.Errorf("upload failed: %w", uploadErr)
+	}
+
+	return nil
+}
+
+// writeArchive writes the whole backup archive to w, encrypted if configured
+func writeArchive(w io.Writer, settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	if encryption.Enabled(settings) {
+		logger.Info("Encrypting backup archive")
+		encrypted, err := encryption.NewWriter(w, settings)
+		if err != nil {
+			return fmt.Errorf("failed to set up encryption: %w", err)
+		}
+		if err := writePlainArchive(encrypted, settings, giteaConfig); err != nil {
+			return err
+		}
+		return encrypted.Close()
+	}
+
+	return writePlainArchive(w, settings, giteaConfig)
+}
+
+// writePlainArchive writes the backup archive to w
+func writePlainArchive(w io.Writer, settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	backupManifest, err := newManifest(settings, giteaConfig)
+	if err != nil {
+		return err
+	}
+
+	archive, err := compression.NewArchive(w, settings, backupManifest)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Streaming %s archive", archive.Format())
+
+	// Backup database
+	if err := database.StreamDatabase(archive, settings, giteaConfig); err != nil {
+		return err
+	}
+
+	// Backup files
+	if err := files.StreamFiles(archive, giteaConfig); err != nil {
+		return fmt.Errorf("file backup failed: %w", err)
+	}
+
+	return archive.Close()
+}
+
+// newManifest returns the manifest of a new backup of the Gitea database
+func newManifest(settings *config.Settings, giteaConfig *config.GiteaConfig) (*manifest.Manifest, error) {
+	adapter, err := database.NewAdapter(settings, giteaConfig.Database.DBType)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.New(giteaConfig.Database.DBType, adapter.DumpName()), nil
+}
+
+// newSigner returns a signer for the configured signing key, or nil if
+// backups are not signed
+func newSigner(settings *config.Settings) (*signing.Signer, error) {
+	if settings.SigningKeyFile == "" {
+		return nil, nil
+	}
+	key, err := signing.ReadPrivateKey(settings.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return signing.NewSigner(key), nil
+}
+
+// hashFile writes the content of the file at path to signer
+func hashFile(signer *signing.Signer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(signer, file)
+	return err
+}
+
+// uploadSignature uploads the signature of the archive next to it
+func uploadSignature(settings *config.Settings, signer *signing.Signer) error {
+	sig, err := signer.Signature(settings.BackupTmpRemoteFilename)
+	if err != nil {
+		return err
+	}
+
+	name := settings.BackupTmpRemoteFilename + signing.Suffix
+	if err := storage.UploadStream(settings, name, bytes.NewReader(sig), int64(len(sig))); err != nil {
+		return fmt.Errorf("signature upload failed: %w", err)
+	}
+
+	logger.Infof("Backup archive signed, signature uploaded as %s", name)
+	return nil
+}
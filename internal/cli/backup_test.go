@@ -0,0 +1,308 @@
+package cli
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+	"github.com/Frantche/gitea-backup-restore-process/internal/signing"
+)
+
+// createSQLiteDatabase creates a Gitea-like SQLite database at path, skipping
+// the test when the sqlite3 command the backup relies on is missing
+func createSQLiteDatabase(t *testing.T, path string) {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	querySQLite(t, path, "CREATE TABLE repository (name TEXT); INSERT INTO repository VALUES ('gitea');")
+}
+
+func querySQLite(t *testing.T, path, query string) string {
+	t.Helper()
+	out, err := exec.Command("sqlite3", path, query).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 %s failed: %v: %s", query, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestRunBackup_LocalBackend(t *testing.T) {
+	tmpDir := t.TempDir()
+	dataDir := filepath.Join(tmpDir, "data")
+	repoDir := filepath.Join(dataDir, "repositories")
+	targetDir := filepath.Join(tmpDir, "target")
+
+	for _, dir := range []string{repoDir, targetDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+
+	dbFile := filepath.Join(dataDir, "gitea.db")
+	createSQLiteDatabase(t, dbFile)
+	if err := os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("test repository content"), 0644); err != nil {
+		t.Fatalf("Failed to create repository file: %v", err)
+	}
+
+	t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+	settings := &config.Settings{
+		BackupMethod:            "local",
+		BackupFileLog:           filepath.Join(tmpDir, "backupFileLog.txt"),
+		BackupTmpRemoteFilename: "gitea-backup-2024-01-01-00-00-00.zip",
+		BackupPrefix:            "gitea-backup",
+		BackupMaxRetention:      5,
+		BackupTmpFolder:         filepath.Join(tmpDir, "backup"),
+		BackupTmpFilename:       filepath.Join(tmpDir, "backup.zip"),
+		RestoreTmpFolder:        filepath.Join(tmpDir, "restore"),
+		RestoreTmpFilename:      filepath.Join(tmpDir, "restore.zip"),
+	}
+
+	giteaConfig := &config.GiteaConfig{
+		Database: config.DatabaseConfig{
+			DBType: "sqlite3",
+			Path:   dbFile,
+		},
+		Repository: config.RepositoryConfig{
+			Root: repoDir,
+		},
+	}
+
+	if err := runBackup(settings, giteaConfig); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	// The archive must have been stored with the remote filename
+	archive := filepath.Join(targetDir, settings.BackupTmpRemoteFilename)
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatalf("Failed to open stored archive: %v", err)
+	}
+	defer zr.Close()
+
+	entries := make(map[string]bool)
+	for _, f := range zr.File {
+		entries[f.Name] = true
+	}
+	for _, expected := range []string{"dump.sqlite3.db", "repo/test.txt", "manifest.json"} {
+		if !entries[expected] {
+			t.Errorf("Expected archive to contain %s", expected)
+		}
+	}
+
+	// The backup must have been recorded in the history log
+	content, err := os.ReadFile(settings.BackupFileLog)
+	if err != nil {
+		t.Fatalf("Failed to read history log: %v", err)
+	}
+	if strings.TrimSpace(string(content)) != settings.BackupTmpRemoteFilename {
+		t.Errorf("Expected history log to contain %s, got %s", settings.BackupTmpRemoteFilename, content)
+	}
+}
+
+func TestRunBackup_Streaming(t *testing.T) {
+	// Streaming backups are zip only
+	format := config.ArchiveFormatZip
+	tmpDir := t.TempDir()
+	dataDir := filepath.Join(tmpDir, "data")
+	repoDir := filepath.Join(dataDir, "repositories")
+	targetDir := filepath.Join(tmpDir, "target")
+
+	for _, dir := range []string{filepath.Join(repoDir, "user", "repo.git"), targetDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+
+	dbFile := filepath.Join(dataDir, "gitea.db")
+	createSQLiteDatabase(t, dbFile)
+	if err := os.WriteFile(filepath.Join(repoDir, "user", "repo.git", "HEAD"), []byte("ref: refs/heads/main"), 0644); err != nil {
+		t.Fatalf("Failed to create repository file: %v", err)
+	}
+
+	t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+	settings := &config.Settings{
+		BackupMethod:            "local",
+		BackupFileLog:           filepath.Join(tmpDir, "backupFileLog.txt"),
+		BackupTmpRemoteFilename: "gitea-backup-2024-01-01-00-00-00." + format,
+		BackupPrefix:            "gitea-backup",
+		BackupMaxRetention:      5,
+		BackupArchiveFormat:     format,
+		BackupStreaming:         true,
+		BackupTmpFolder:         filepath.Join(tmpDir, "backup"),
+		BackupTmpFilename:       filepath.Join(tmpDir, "backup.zip"),
+		RestoreTmpFolder:        filepath.Join(tmpDir, "restore"),
+		RestoreTmpFilename:      filepath.Join(targetDir, "gitea-backup-2024-01-01-00-00-00."+format),
+	}
+
+	giteaConfig := &config.GiteaConfig{
+		Database: config.DatabaseConfig{
+			DBType: "sqlite3",
+			Path:   dbFile,
+		},
+		Repository: config.RepositoryConfig{
+			Root: repoDir,
+		},
+	}
+
+	if err := runBackup(settings, giteaConfig); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	// Nothing must have been staged on disk
+	for _, path := range []string{settings.BackupTmpFolder, settings.BackupTmpFilename} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to exist in streaming mode", path)
+		}
+	}
+
+	// The stored archive must have the same layout as a staged backup
+	if err := compression.ExtractZip(settings); err != nil {
+		t.Fatalf("Failed to extract stored archive: %v", err)
+	}
+	if got := querySQLite(t, filepath.Join(settings.RestoreTmpFolder, "dump.sqlite3.db"), "SELECT name FROM repository"); got != "gitea" {
+		t.Errorf("Unexpected database content: %q", got)
+	}
+	expected := map[string]string{
+		"repo/user/repo.git/HEAD": "ref: refs/heads/main",
+	}
+	for name, want := range expected {
+		content, err := os.ReadFile(filepath.Join(settings.RestoreTmpFolder, name))
+		if err != nil {
+			t.Errorf("Expected archive to contain %s: %v", name, err)
+			continue
+		}
+		if string(content) != want {
+			t.Errorf("Unexpected content for %s: %q", name, content)
+		}
+	}
+
+	backupManifest, err := manifest.Read(settings.RestoreTmpFolder)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if backupManifest.DBType != "sqlite3" || backupManifest.DumpFile != "dump.sqlite3.db" {
+		t.Errorf("Unexpected manifest metadata: %+v", backupManifest)
+	}
+	if err := backupManifest.Verify(settings.RestoreTmpFolder); err != nil {
+		t.Errorf("Manifest verification failed: %v", err)
+	}
+}
+
+func TestRunBackup_StreamingFailureLeavesNoArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	targetDir := filepath.Join(tmpDir, "target")
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory %s: %v", targetDir, err)
+	}
+
+	t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+	settings := &config.Settings{
+		BackupMethod:            "local",
+		BackupFileLog:           filepath.Join(tmpDir, "backupFileLog.txt"),
+		BackupTmpRemoteFilename: "gitea-backup-2024-01-01-00-00-00.zip",
+		BackupPrefix:            "gitea-backup",
+		BackupStreaming:         true,
+	}
+
+	// The database file is missing, so the dump fails mid-stream
+	giteaConfig := &config.GiteaConfig{
+		Database: config.DatabaseConfig{
+			DBType: "sqlite3",
+			Path:   filepath.Join(tmpDir, "missing.db"),
+		},
+	}
+
+	if err := runBackup(settings, giteaConfig); err == nil {
+		t.Fatal("Expected backup to fail, got nil")
+	}
+
+	entries, err := os.ReadDir(targetDir)
+	if err != nil {
+		t.Fatalf("Failed to list target directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no archive to be stored, found %d entries", len(entries))
+	}
+	if _, err := os.Stat(settings.BackupFileLog); !os.IsNotExist(err) {
+		t.Error("Expected failed backup not to be recorded in the history log")
+	}
+}
+
+func TestRunBackup_Signed(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		name := "staged"
+		if streaming {
+			name = "streaming"
+		}
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			dataDir := filepath.Join(tmpDir, "data")
+			targetDir := filepath.Join(tmpDir, "target")
+			for _, dir := range []string{filepath.Join(dataDir, "repositories"), targetDir} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("Failed to create directory %s: %v", dir, err)
+				}
+			}
+			dbFile := filepath.Join(dataDir, "gitea.db")
+			createSQLiteDatabase(t, dbFile)
+
+			public, private, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatalf("Failed to generate key: %v", err)
+			}
+			der, err := x509.MarshalPKCS8PrivateKey(private)
+			if err != nil {
+				t.Fatalf("Failed to marshal key: %v", err)
+			}
+			keyFile := filepath.Join(tmpDir, "backup.key")
+			if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+				t.Fatalf("Failed to write key: %v", err)
+			}
+
+			t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+			settings := &config.Settings{
+				BackupMethod:            "local",
+				BackupFileLog:           filepath.Join(tmpDir, "backupFileLog.txt"),
+				BackupTmpRemoteFilename: "gitea-backup-2024-01-01-00-00-00.zip",
+				BackupPrefix:            "gitea-backup",
+				BackupMaxRetention:      5,
+				BackupStreaming:         streaming,
+				SigningKeyFile:          keyFile,
+				BackupTmpFolder:         filepath.Join(tmpDir, "backup"),
+				BackupTmpFilename:       filepath.Join(tmpDir, "backup.zip"),
+			}
+			giteaConfig := &config.GiteaConfig{
+				Database:   config.DatabaseConfig{DBType: "sqlite3", Path: dbFile},
+				Repository: config.RepositoryConfig{Root: filepath.Join(dataDir, "repositories")},
+			}
+
+			if err := runBackup(settings, giteaConfig); err != nil {
+				t.Fatalf("Backup failed: %v", err)
+			}
+
+			archive := filepath.Join(targetDir, settings.BackupTmpRemoteFilename)
+			sig, err := os.ReadFile(archive + signing.Suffix)
+			if err != nil {
+				t.Fatalf("Expected signature to be stored next to the archive: %v", err)
+			}
+			if err := signing.VerifyFile(archive, sig, public, settings.BackupTmpRemoteFilename); err != nil {
+				t.Errorf("Signature verification failed: %v", err)
+			}
+		})
+	}
+}
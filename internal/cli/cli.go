@@ -0,0 +1,177 @@
+// Package cli implements the gitea-br command line and its subcommands.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+// programName is the name of the single binary
+const programName = "gitea-br"
+
+// command is a gitea-br subcommand
+type command struct {
+	Name        string
+	Summary     string
+	Description string
+	// Flags defines the flags specific to the command, if any
+	Flags func(fs *flag.FlagSet)
+	// Run runs the command, writing its results to stdout
+	Run func(settings *config.Settings, stdout io.Writer) error
+}
+
+// commands returns every subcommand, in the order of the usage message
+func commands() []*command {
+	return []*command{
+		backupCommand(),
+		restoreCommand(),
+		listCommand(),
+		verifyCommand(),
+		pruneCommand(),
+		inspectCommand(),
+	}
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands() {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// Main runs the gitea-br command line, args excluding the program name, and
+// returns the process exit code
+func Main(args []string) int {
+	return run(args, os.Stdout, os.Stderr)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		writeUsage(stderr)
+		return 2
+	}
+
+	switch name := args[0]; name {
+	case "-h", "-help", "--help":
+		writeUsage(stdout)
+		return 0
+	case "help":
+		if len(args) < 2 {
+			writeUsage(stdout)
+			return 0
+		}
+		cmd := findCommand(args[1])
+		if cmd == nil {
+			fmt.Fprintf(stderr, "%s: unknown command %q\n", programName, args[1])
+			return 2
+		}
+		fs, _ := newFlagSet(cmd, stdout)
+		fs.Usage()
+		return 0
+	default:
+		cmd := findCommand(name)
+		if cmd == nil {
+			fmt.Fprintf(stderr, "%s: unknown command %q\n\n", programName, name)
+			writeUsage(stderr)
+			return 2
+		}
+		return runCommand(cmd, args[1:], stdout, stderr)
+	}
+}
+
+// RunCommand runs the named subcommand with args, excluding the program name,
+// and returns the process exit code. It backs the single purpose binaries
+// such as gitea-backup.
+func RunCommand(name string, args []string) int {
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "%s: unknown command %q\n", programName, name)
+		return 2
+	}
+	return runCommand(cmd, args, os.Stdout, os.Stderr)
+}
+
+func runCommand(cmd *command, args []string, stdout, stderr io.Writer) int {
+	fs, overrides := newFlagSet(cmd, stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "%s %s: unexpected argument %q\n", programName, cmd.Name, fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+
+	// Load configuration
+	settings, err := config.NewSettingsWithOverrides(overrides)
+	if err != nil {
+		logger.Errorf("Failed to load configuration: %v", err)
+		return 1
+	}
+
+	if err := logger.Configure(settings.LogLevel, settings.LogFormat); err != nil {
+		logger.Errorf("Failed to configure logging: %v", err)
+		return 1
+	}
+
+	logger.Debugf("Settings: %+v", settings)
+
+	if err := cmd.Run(settings, stdout); err != nil {
+		logger.With("command", cmd.Name).Error(capitalize(cmd.Name)+" failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// runStage runs fn as the named stage of a command, logging its duration.
+// The error it fails with is logged by runCommand.
+func runStage(name string, fn func() error) error {
+	done := logger.Stage(name)
+	err := fn()
+	done(err)
+	return err
+}
+
+// newFlagSet returns the flag set of cmd, its own flags followed by a flag for
+// every setting, with the overrides the setting flags are collected in
+func newFlagSet(cmd *command, output io.Writer) (*flag.FlagSet, map[string]string) {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	overrides := config.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(output, "Usage: %s %s [flags]\n\n%s\n\n", programName, cmd.Name, cmd.Description)
+		fmt.Fprintf(output, "Each flag overrides the environment variable shown next to it.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	return fs, overrides
+}
+
+func writeUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", programName)
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintf(w, "\nRun \"%s help <command>\" for the flags of a command.\n", programName)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--help"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	for _, cmd := range commands() {
+		if !strings.Contains(stdout.String(), cmd.Name) {
+			t.Errorf("Expected usage to list %s:\n%s", cmd.Name, stdout.String())
+		}
+	}
+
+	if code := run(nil, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 without a command, got %d", code)
+	}
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"frobnicate"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), `unknown command "frobnicate"`) {
+		t.Errorf("Unexpected error output: %s", stderr.String())
+	}
+}
+
+func TestRun_CommandHelp(t *testing.T) {
+	for _, args := range [][]string{{"help", "prune"}, {"prune", "--help"}} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d", args, code)
+		}
+		help := stdout.String() + stderr.String()
+		for _, want := range []string{"Usage: gitea-br prune", "-dry-run", "(env BACKUP_RETENTION_DRY_RUN)", "-max-age"} {
+			if !strings.Contains(help, want) {
+				t.Errorf("%v: expected help to contain %q:\n%s", args, want, help)
+			}
+		}
+	}
+}
+
+func TestRun_BadFlag(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"list", "--no-such-flag"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2, got %d", code)
+	}
+	if code := run([]string{"list", "extra"}, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 for an extra argument, got %d", code)
+	}
+}
+
+func TestRun_FlagsOverrideEnvironment(t *testing.T) {
+	settings := newListSettings(t)
+	emptyDir := t.TempDir()
+	// The environment points at an empty directory, the flag at the backups
+	t.Setenv("BACKUP_PREFIX", "other")
+	t.Setenv("BACKUP_METHOD", "local")
+	t.Setenv("BACKUP_FILE_LOG", filepath.Join(emptyDir, "backupFileLog.txt"))
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"list", "--prefix", settings.BackupPrefix, "--file-log", settings.BackupFileLog}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "2 backups") {
+		t.Errorf("Expected the flag to select the gitea-backup prefix:\n%s", stdout.String())
+	}
+}
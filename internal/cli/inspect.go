@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/encryption"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+	"github.com/Frantche/gitea-backup-restore-process/internal/storage"
+)
+
+// inspectReport describes the content of a backup
+type inspectReport struct {
+	Backup   string             `json:"backup"`
+	Format   string             `json:"format"`
+	Manifest *manifest.Manifest `json:"manifest,omitempty"`
+	// Files lists the archive entries of backups without a manifest
+	Files []manifest.Entry `json:"files,omitempty"`
+}
+
+func inspectCommand() *command {
+	var output string
+	return &command{
+		Name:        "inspect",
+		Summary:     "show the content of a remote backup",
+		Description: "Downloads the backup named by --file and shows its manifest: when and where\nit was taken, its database dump and the size of its content. Backups\ntaken before manifests were introduced are listed entry by entry.",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&output, "output", outputTable, "output format: table or json")
+		},
+		Run: func(settings *config.Settings, stdout io.Writer) error {
+			return runInspect(settings, stdout, output)
+		},
+	}
+}
+
+// runInspect downloads a backup and writes a description of its content to w
+func runInspect(settings *config.Settings, w io.Writer, output string) error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("unsupported output format %q, expected %s or %s", output, outputTable, outputJSON)
+	}
+	if settings.BackupFilename == "" {
+		return fmt.Errorf("no backup to inspect: set --file or BACKUP_FILENAME")
+	}
+
+	// Resolve BACKUP_FILENAME=latest or a date to a backup name
+	if err := storage.ResolveBackupFilename(settings); err != nil {
+		return err
+	}
+
+	if err := storage.Download(settings); err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer os.Remove(settings.RestoreTmpFilename)
+
+	if err := encryption.DecryptFile(settings); err != nil {
+		return err
+	}
+
+	report, err := inspectArchive(settings.RestoreTmpFilename)
+	if err != nil {
+		return err
+	}
+	report.Backup = settings.BackupFilename
+
+	if output == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return writeInspectReport(w, report)
+}
+
+// inspectArchive reads the manifest of the archive at path, or lists its
+// entries when it has none
+func inspectArchive(path string) (*inspectReport, error) {
+	format, err := compression.DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &inspectReport{Format: format}
+
+	data, err := compression.ReadEntry(path, manifest.FileName)
+	if err == nil {
+		report.Manifest, err = manifest.Parse(data)
+		return report, err
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	err = compression.WalkArchive(path, func(name string, r io.Reader) error {
+		hasher := manifest.NewHasher()
+		if _, err := io.Copy(hasher, r); err != nil {
+			return err
+		}
+		report.Files = append(report.Files, manifest.Entry{Name: name, Size: hasher.Size(), SHA256: hex.EncodeToString(hasher.Sum())})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// writeInspectReport writes a summary of the backup followed by the number
+// of files and size of each top level directory of the archive
+func writeInspectReport(w io.Writer, report *inspectReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Backup:\t%s\n", report.Backup)
+	fmt.Fprintf(tw, "Format:\t%s\n", report.Format)
+
+	files := report.Files
+	if m := report.Manifest; m != nil {
+		files = m.Files
+		fmt.Fprintf(tw, "Created:\t%s\n", m.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(tw, "Host:\t%s\n", m.Hostname)
+		fmt.Fprintf(tw, "Tool version:\t%s\n", m.ToolVersion)
+		fmt.Fprintf(tw, "Database:\t%s (%s)\n", m.DBType, m.DumpFile)
+	} else {
+		fmt.Fprintf(tw, "Manifest:\tnone\n")
+	}
+
+	var total int64
+	for _, file := range files {
+		total += file.Size
+	}
+	fmt.Fprintf(tw, "Files:\t%d, %s\n", len(files), config.FormatSize(total))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	return writeContentTable(w, files)
+}
+
+// contentSummary sums up the files under one top level path of the archive
+type contentSummary struct {
+	Path  string
+	Files int
+	Size  int64
+}
+
+func writeContentTable(w io.Writer, files []manifest.Entry) error {
+	summaries := make(map[string]*contentSummary)
+	for _, file := range files {
+		top, _, _ := strings.Cut(file.Name, "/")
+		if top != file.Name {
+			top += "/"
+		}
+		summary, ok := summaries[top]
+		if !ok {
+			summary = &contentSummary{Path: top}
+			summaries[top] = summary
+		}
+		summary.Files++
+		summary.Size += file.Size
+	}
+
+	paths := make([]string, 0, len(summaries))
+	for path := range summaries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tFILES\tSIZE")
+	for _, path := range paths {
+		summary := summaries[path]
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", summary.Path, summary.Files, config.FormatSize(summary.Size))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+	"github.com/Frantche/gitea-backup-restore-process/internal/storage"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+func newInspectSettings(t *testing.T, m *manifest.Manifest) *config.Settings {
+	t.Helper()
+	tmpDir := t.TempDir()
+	targetDir := filepath.Join(tmpDir, "target")
+	backupDir := filepath.Join(tmpDir, "backup")
+	files := map[string]string{
+		"dump.mysql.sql":      "-- MySQL dump\n-- Dump completed\n",
+		"repositories/a/HEAD": "ref: refs/heads/main",
+		"repositories/b/HEAD": "ref: refs/heads/main",
+		"data/avatars/1.png":  "png",
+	}
+	for name, content := range files {
+		path := filepath.Join(backupDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory %s: %v", targetDir, err)
+	}
+	t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+	settings := &config.Settings{
+		BackupMethod:       "local",
+		BackupPrefix:       "gitea-backup",
+		BackupFilename:     storage.LatestBackup,
+		BackupTmpFolder:    backupDir,
+		BackupTmpFilename:  filepath.Join(targetDir, "gitea-backup-2024-01-01-00-00-00.zip"),
+		RestoreTmpFilename: filepath.Join(tmpDir, "restore.zip"),
+	}
+	if err := compression.CreateZip(settings, m); err != nil {
+		t.Fatalf("CreateZip failed: %v", err)
+	}
+	return settings
+}
+
+func TestRunInspect_Manifest(t *testing.T) {
+	settings := newInspectSettings(t, manifest.New("mysql", "dump.mysql.sql"))
+
+	var out bytes.Buffer
+	if err := runInspect(settings, &out, outputTable); err != nil {
+		t.Fatalf("runInspect failed: %v", err)
+	}
+	for _, want := range []string{
+		"gitea-backup-2024-01-01-00-00-00.zip",
+		"mysql (dump.mysql.sql)",
+		"Files:",
+		"repositories/",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q:\n%s", want, out.String())
+		}
+	}
+
+	// Nothing is left behind
+	if _, err := os.Stat(settings.RestoreTmpFilename); !os.IsNotExist(err) {
+		t.Errorf("Expected downloaded archive to be removed")
+	}
+}
+
+func TestRunInspect_NoManifestJSON(t *testing.T) {
+	settings := newInspectSettings(t, nil)
+
+	var out bytes.Buffer
+	if err := runInspect(settings, &out, outputJSON); err != nil {
+		t.Fatalf("runInspect failed: %v", err)
+	}
+	var report inspectReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out.String())
+	}
+	if report.Manifest != nil || len(report.Files) != 4 {
+		t.Errorf("Expected the 4 archive entries without a manifest, got %+v", report)
+	}
+}
+
+func TestRunCommand_InspectJSONStdout(t *testing.T) {
+	settings := newInspectSettings(t, manifest.New("mysql", "dump.mysql.sql"))
+	t.Setenv("BACKUP_METHOD", "local")
+	t.Setenv("BACKUP_PREFIX", settings.BackupPrefix)
+	t.Setenv("RESTORE_TMP_FILENAME", settings.RestoreTmpFilename)
+
+	// Commands and logs write to the process stdout and stderr
+	previousLogger := logger.Default()
+	previousStdout := os.Stdout
+	stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatalf("Failed to create stdout: %v", err)
+	}
+	defer stdout.Close()
+	os.Stdout = stdout
+	t.Cleanup(func() {
+		os.Stdout = previousStdout
+		logger.SetHandler(previousLogger.Handler())
+	})
+
+	if code := RunCommand("inspect", []string{"--file", storage.LatestBackup, "--output", outputJSON}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	// Logs must not get in the way of programs reading the JSON output
+	data, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatalf("Failed to read stdout: %v", err)
+	}
+	var report inspectReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, data)
+	}
+	if report.Manifest == nil || report.Manifest.DBType != "mysql" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+}
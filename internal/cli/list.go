@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/history"
+	"github.com/Frantche/gitea-backup-restore-process/internal/storage"
+)
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// backupEntry is one backup of the listing
+type backupEntry struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Time       time.Time `json:"time"`
+	AgeSeconds int64     `json:"age_seconds"`
+	InHistory  bool      `json:"in_history"`
+}
+
+func listCommand() *command {
+	var output string
+	return &command{
+		Name:        "list",
+		Summary:     "list the backups stored on the remote storage",
+		Description: "Lists the backups stored under the prefix, newest first, with their size,\ndate and age. Backups recorded in the history log are marked.",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&output, "output", outputTable, "output format: table or json")
+		},
+		Run: func(settings *config.Settings, stdout io.Writer) error {
+			return runList(settings, stdout, output, time.Now())
+		},
+	}
+}
+
+// runList writes the backups stored on the configured backend to w, newest
+// first, in the given output format
+func runList(settings *config.Settings, w io.Writer, output string, now time.Time) error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("unsupported output format %q, expected %s or %s", output, outputTable, outputJSON)
+	}
+
+	backups, err := storage.ListBackups(settings)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	logged, err := history.Names(settings)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]backupEntry, 0, len(backups))
+	for _, backup := range backups {
+		t := storage.BackupTime(settings, backup)
+		entries = append(entries, backupEntry{
+			Name:       backup.Name,
+			Size:       backup.Size,
+			Time:       t,
+			AgeSeconds: int64(now.Sub(t).Seconds()),
+			InHistory:  logged[backup.Name],
+		})
+	}
+
+	if output == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+	return writeTable(w, entries)
+}
+
+// writeTable writes entries as an aligned table. Backups found in the
+// history log are marked with a star.
+func writeTable(w io.Writer, entries []backupEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZE\tTIME\tAGE\tHISTORY")
+	for _, entry := range entries {
+		marker := ""
+		if entry.InHistory {
+			marker = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			entry.Name,
+			config.FormatSize(entry.Size),
+			entry.Time.Format("2006-01-02 15:04:05"),
+			formatAge(time.Duration(entry.AgeSeconds)*time.Second),
+			marker,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d backups\n", len(entries))
+	return nil
+}
+
+// formatAge formats an age with its two largest units, such as "3d 4h"
+func formatAge(age time.Duration) string {
+	if age < 0 {
+		age = 0
+	}
+	days := int64(age / (24 * time.Hour))
+	hours := int64(age/time.Hour) % 24
+	minutes := int64(age/time.Minute) % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+func newListSettings(t *testing.T) *config.Settings {
+	t.Helper()
+	tmpDir := t.TempDir()
+	targetDir := filepath.Join(tmpDir, "target")
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory %s: %v", targetDir, err)
+	}
+	t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+	files := map[string]int{
+		"gitea-backup-2024-03-14-02-00-00.zip":     100,
+		"gitea-backup-2024-03-15-02-00-00.zip":     2048,
+		"gitea-backup-2024-03-15-02-00-00.zip.sig": 10,
+		"other-2024-03-15-02-00-00.zip":            1,
+	}
+	for name, size := range files {
+		if err := os.WriteFile(filepath.Join(targetDir, name), make([]byte, size), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	settings := &config.Settings{
+		BackupMethod:  "local",
+		BackupPrefix:  "gitea-backup",
+		BackupFileLog: filepath.Join(tmpDir, "backupFileLog.txt"),
+	}
+	if err := os.WriteFile(settings.BackupFileLog, []byte("gitea-backup-2024-03-15-02-00-00.zip\n"), 0644); err != nil {
+		t.Fatalf("Failed to create history log: %v", err)
+	}
+	return settings
+}
+
+func TestRunList_JSON(t *testing.T) {
+	settings := newListSettings(t)
+	now := time.Date(2024, 3, 16, 2, 0, 0, 0, time.Local)
+
+	var out bytes.Buffer
+	if err := runList(settings, &out, outputJSON, now); err != nil {
+		t.Fatalf("runList failed: %v", err)
+	}
+
+	var entries []backupEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out.String())
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 backups, got %+v", entries)
+	}
+	newest := entries[0]
+	if newest.Name != "gitea-backup-2024-03-15-02-00-00.zip" || newest.Size != 2048 || !newest.InHistory {
+		t.Errorf("Unexpected newest backup: %+v", newest)
+	}
+	if newest.AgeSeconds != 24*60*60 {
+		t.Errorf("Expected an age of one day, got %ds", newest.AgeSeconds)
+	}
+	if entries[1].InHistory {
+		t.Errorf("Expected %s not to be in the history log", entries[1].Name)
+	}
+}
+
+func TestRunList_Table(t *testing.T) {
+	settings := newListSettings(t)
+	now := time.Date(2024, 3, 16, 5, 0, 0, 0, time.Local)
+
+	var out bytes.Buffer
+	if err := runList(settings, &out, outputTable, now); err != nil {
+		t.Fatalf("runList failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected header, 2 backups and a total, got:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[0], "NAME") {
+		t.Errorf("Expected a header line, got %q", lines[0])
+	}
+	for _, want := range []string{"gitea-backup-2024-03-15-02-00-00.zip", "2.0 KiB", "1d 3h", "*"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("Expected %q in %q", want, lines[1])
+		}
+	}
+	if strings.HasSuffix(strings.TrimSpace(lines[2]), "*") {
+		t.Errorf("Expected no history marker in %q", lines[2])
+	}
+}
+
+func TestRunList_UnsupportedOutput(t *testing.T) {
+	if err := runList(&config.Settings{}, &bytes.Buffer{}, "xml", time.Now()); err == nil {
+		t.Error("Expected error for unsupported output format, got nil")
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := map[time.Duration]string{
+		-time.Minute:                "0m",
+		42 * time.Minute:            "42m",
+		3*time.Hour + 5*time.Minute: "3h 5m",
+		50 * time.Hour:              "2d 2h",
+	}
+	for age, want := range tests {
+		if got := formatAge(age); got != want {
+			t.Errorf("formatAge(%s) = %s, want %s", age, got, want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"io"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/storage"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+func pruneCommand() *command {
+	return &command{
+		Name:        "prune",
+		Summary:     "apply the retention policy to the remote storage",
+		Description: "Deletes the backups that fall outside the retention policy. With --dry-run,\nevery keep or delete decision is listed and nothing is deleted.",
+		Run:         prune,
+	}
+}
+
+func prune(settings *config.Settings, stdout io.Writer) error {
+	logger.Info("Starting retention pruning")
+
+	if err := storage.EnsureMaxRetention(settings); err != nil {
+		return err
+	}
+
+	logger.Info("Retention pruning completed successfully")
+	return nil
+}
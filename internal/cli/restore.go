@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/database"
+	"github.com/Frantche/gitea-backup-restore-process/internal/encryption"
+	"github.com/Frantche/gitea-backup-restore-process/internal/files"
+	"github.com/Frantche/gitea-backup-restore-process/internal/history"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+	"github.com/Frantche/gitea-backup-restore-process/internal/storage"
+	"github.com/Frantche/gitea-backup-restore-process/internal/verify"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+func restoreCommand() *command {
+	return &command{
+		Name:        "restore",
+		Summary:     "restore a backup over the Gitea database and data",
+		Description: "Downloads the backup named by --file, checks its signature and manifest,\nthen restores the repositories, avatars and database.",
+		Run:         restore,
+	}
+}
+
+func restore(settings *config.Settings, stdout io.Writer) error {
+	logger.Info("Starting restore process")
+
+	// Read Gitea configuration
+	giteaConfig, err := config.ReadGiteaConfig(settings.AppIniPath)
+	if err != nil {
+		return fmt.Errorf("failed to read Gitea configuration: %w", err)
+	}
+
+	logger.Debugf("Gitea config: %+v", giteaConfig)
+
+	if err := runRestore(settings, giteaConfig); err != nil {
+		return err
+	}
+
+	logger.Info("Restore process completed successfully")
+	return nil
+}
+
+func runRestore(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	// Resolve BACKUP_FILENAME=latest or a date to a backup name
+	if err := storage.ResolveBackupFilename(settings); err != nil {
+		return err
+	}
+
+	// Check if restore has already been performed for this backup
+	alreadyRestored, err := history.Check(settings)
+	if err != nil {
+		return fmt.Errorf("failed to check restore history: %w", err)
+	}
+
+	if alreadyRestored {
+		logger.Info("Gitea has already been restored with this file version")
+		return nil
+	}
+
+	// Download from remote storage
+	if err := runStage("download", func() error { return storage.Download(settings) }); err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+
+	// Refuse archives that are not signed by the configured key
+	if _, err := verify.Signature(settings); err != nil {
+		return fmt.Errorf("refusing to restore %s: %w", settings.BackupFilename, err)
+	}
+
+	// Decrypt backup archive, if encrypted
+	if err := encryption.DecryptFile(settings); err != nil {
+		return err
+	}
+
+	// Extract backup archive
+	if err := runStage("extract", func() error { return compression.ExtractZip(settings) }); err != nil {
+		return fmt.Errorf("failed to extract archive: %w", err)
+	}
+
+	// Verify archive content before touching live data
+	if err := runStage("verify", func() error { return verifyManifest(settings, giteaConfig) }); err != nil {
+		return err
+	}
+
+	// Restore files
+	if err := runStage("files_restore", func() error { return files.RestoreFiles(settings, giteaConfig) }); err != nil {
+		return fmt.Errorf("file restore failed: %w", err)
+	}
+
+	// Restore database
+	if err := runStage("database_restore", func() error { return database.RestoreDatabase(settings, giteaConfig) }); err != nil {
+		return fmt.Errorf("database restore failed: %w", err)
+	}
+
+	// Add to history
+	if err := history.Increment(settings, settings.BackupFilename); err != nil {
+		return fmt.Errorf("failed to update restore history: %w", err)
+	}
+
+	return nil
+}
+
+// verifyManifest checks the extracted archive against its manifest
+func verifyManifest(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	backupManifest, err := manifest.Read(settings.RestoreTmpFolder)
+	if errors.Is(err, manifest.ErrNotFound) {
+		logger.Info("Backup has no manifest, skipping checksum verification")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Verifying %d files from backup created %s on %s by %s",
+		len(backupManifest.Files), backupManifest.CreatedAt.Format(time.RFC3339), backupManifest.Hostname, backupManifest.ToolVersion)
+
+	if backupManifest.DBType != giteaConfig.Database.DBType {
+		return fmt.Errorf("backup contains a %s database but Gitea is configured for %s", backupManifest.DBType, giteaConfig.Database.DBType)
+	}
+
+	if err := backupManifest.Verify(settings.RestoreTmpFolder); err != nil {
+		return fmt.Errorf("backup verification failed: %w", err)
+	}
+
+	logger.Info("Backup checksums verified successfully")
+	return nil
+}
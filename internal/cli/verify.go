@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/encryption"
+	"github.com/Frantche/gitea-backup-restore-process/internal/storage"
+	"github.com/Frantche/gitea-backup-restore-process/internal/verify"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+func verifyCommand() *command {
+	return &command{
+		Name:        "verify",
+		Summary:     "check a remote backup without restoring it",
+		Description: "Downloads a backup and checks its signature, archive checksums, manifest\nand database dump. Without --file, the latest remote backup is checked. Exits non-zero if any check fails.",
+		Run:         verifyBackup,
+	}
+}
+
+func verifyBackup(settings *config.Settings, stdout io.Writer) error {
+	logger.Info("Starting backup verification")
+
+	report, err := runVerify(settings)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(stdout, report)
+	if !report.OK() {
+		return fmt.Errorf("backup %s failed verification", report.Backup)
+	}
+
+	logger.Info("Backup verification completed successfully")
+	return nil
+}
+
+// runVerify downloads a backup and checks it without restoring anything
+func runVerify(settings *config.Settings) (*verify.Report, error) {
+	// The history log also records restores, so the newest backup comes
+	// from the remote storage
+	if settings.BackupFilename == "" {
+		logger.Info("Verifying the latest backup")
+		settings.BackupFilename = storage.LatestBackup
+	}
+
+	// Resolve BACKUP_FILENAME=latest or a date to a backup name
+	if err := storage.ResolveBackupFilename(settings); err != nil {
+		return nil, err
+	}
+
+	// Download from remote storage
+	if err := storage.Download(settings); err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	defer os.Remove(settings.RestoreTmpFilename)
+
+	// A bad signature is reported, the archive is still checked
+	signature := "not checked, BACKUP_SIGNING_PUBLIC_KEY_FILE is not set"
+	verified, sigErr := verify.Signature(settings)
+	switch {
+	case sigErr != nil:
+		signature = "FAILED"
+	case verified:
+		signature = "verified"
+	}
+
+	// Decrypt backup archive, if encrypted
+	if err := encryption.DecryptFile(settings); err != nil {
+		return nil, err
+	}
+
+	// The database type comes from the Gitea configuration when available,
+	// from the backup manifest otherwise
+	dbType := ""
+	if giteaConfig, err := config.ReadGiteaConfig(settings.AppIniPath); err != nil {
+		logger.Debugf("Gitea configuration not available, using the backup manifest: %v", err)
+	} else {
+		dbType = giteaConfig.Database.DBType
+	}
+
+	report, err := verify.Archive(settings.RestoreTmpFilename, dbType)
+	if err != nil {
+		return nil, err
+	}
+	report.Backup = settings.BackupFilename
+	report.Signature = signature
+	if sigErr != nil {
+		report.Problems = append([]string{fmt.Sprintf("signature: %v", sigErr)}, report.Problems...)
+	}
+
+	return report, nil
+}
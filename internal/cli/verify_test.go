@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/history"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+)
+
+func TestRunVerify_LatestBackup(t *testing.T) {
+	tmpDir := t.TempDir()
+	targetDir := filepath.Join(tmpDir, "target")
+	backupDir := filepath.Join(tmpDir, "backup")
+	for _, dir := range []string{targetDir, backupDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory %s: %v", dir, err)
+		}
+	}
+	dump := "--\n-- PostgreSQL database dump\n--\nCREATE TABLE t;\n--\n-- PostgreSQL database dump complete\n--\n"
+	if err := os.WriteFile(filepath.Join(backupDir, "dump.postgres.sql"), []byte(dump), 0644); err != nil {
+		t.Fatalf("Failed to create dump: %v", err)
+	}
+
+	t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+	settings := &config.Settings{
+		BackupMethod:       "local",
+		BackupPrefix:       "gitea-backup",
+		BackupFileLog:      filepath.Join(tmpDir, "backupFileLog.txt"),
+		BackupTmpFolder:    backupDir,
+		BackupTmpFilename:  filepath.Join(targetDir, "gitea-backup-2024-01-01-00-00-00.zip"),
+		RestoreTmpFilename: filepath.Join(tmpDir, "restore.zip"),
+		AppIniPath:         filepath.Join(tmpDir, "missing-app.ini"),
+	}
+	if err := compression.CreateZip(settings, manifest.New("postgres", "dump.postgres.sql")); err != nil {
+		t.Fatalf("CreateZip failed: %v", err)
+	}
+	// The history log ends with a restored backup that is not in storage
+	if err := history.Increment(settings, "gitea-backup-2023-06-01-00-00-00.zip"); err != nil {
+		t.Fatalf("Failed to record restore: %v", err)
+	}
+
+	report, err := runVerify(settings)
+	if err != nil {
+		t.Fatalf("Verification failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("Expected backup to pass verification, got:\n%s", report)
+	}
+	if report.Backup != "gitea-backup-2024-01-01-00-00-00.zip" || report.DBType != "postgres" {
+		t.Errorf("Unexpected report:\n%s", report)
+	}
+
+	// Nothing is left behind
+	if _, err := os.Stat(settings.RestoreTmpFilename); !os.IsNotExist(err) {
+		t.Errorf("Expected downloaded archive to be removed")
+	}
+}
+
+func TestRunVerify_NoBackup(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("BACKUP_LOCAL_DIR", tmpDir)
+	settings := &config.Settings{
+		BackupMethod:  "local",
+		BackupPrefix:  "gitea-backup",
+		BackupFileLog: filepath.Join(tmpDir, "backupFileLog.txt"),
+	}
+	if _, err := runVerify(settings); err == nil {
+		t.Error("Expected error without any backup to verify, got nil")
+	}
+}
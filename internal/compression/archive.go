@@ -0,0 +1,207 @@
+package compression
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+// Magic bytes used to recognise an archive regardless of its file name
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	zipEmptyMagic = []byte("PK\x05\x06")
+	gzipMagic     = []byte{0x1f, 0x8b}
+	zstdMagic     = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// archiveWriter writes entries to an archive, whatever its format
+type archiveWriter interface {
+	// AddDir adds a directory entry. name uses forward slashes.
+	AddDir(name string, modTime time.Time) error
+	// AddFile adds a regular file of the given size read from r
+	AddFile(name string, size int64, modTime time.Time, r io.Reader) error
+	// AddStream adds a regular file of unknown size read from r until EOF
+	AddStream(name string, modTime time.Time, r io.Reader) error
+	// Close flushes the archive. It does not close the underlying writer.
+	Close() error
+}
+
+// newArchiveWriter returns a writer producing the given format into w.
+// level 0 selects the format's default compression level.
+func newArchiveWriter(w io.Writer, format string, level int) (archiveWriter, error) {
+	switch format {
+	case "", config.ArchiveFormatZip:
+		return newZipArchiveWriter(w, level), nil
+	case config.ArchiveFormatTarGz:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		gz, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip compression level: %w", err)
+		}
+		return &tarArchiveWriter{tw: tar.NewWriter(gz), compressor: gz}, nil
+	case config.ArchiveFormatTarZst:
+		var options []zstd.EOption
+		if level != 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		zw, err := zstd.NewWriter(w, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		return &tarArchiveWriter{tw: tar.NewWriter(zw), compressor: zw}, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func newZipArchiveWriter(w io.Writer, level int) *zipArchiveWriter {
+	zw := zip.NewWriter(w)
+	if level != 0 {
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+	return &zipArchiveWriter{zw: zw}
+}
+
+func (z *zipArchiveWriter) AddDir(name string, modTime time.Time) error {
+	_, err := z.zw.CreateHeader(&zip.FileHeader{
+		Name:     name + "/",
+		Modified: modTime,
+	})
+	return err
+}
+
+func (z *zipArchiveWriter) AddFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	w, err := z.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (z *zipArchiveWriter) AddStream(name string, modTime time.Time, r io.Reader) error {
+	// Zip entries record their size after the data, nothing to do
+	return z.AddFile(name, -1, modTime, r)
+}
+
+func (z *zipArchiveWriter) Close() error {
+	return z.zw.Close()
+}
+
+type tarArchiveWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+}
+
+func (t *tarArchiveWriter) AddDir(name string, modTime time.Time) error {
+	return t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0o755,
+		ModTime:  modTime,
+	})
+}
+
+func (t *tarArchiveWriter) AddFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(t.tw, r)
+	return err
+}
+
+func (t *tarArchiveWriter) AddStream(name string, modTime time.Time, r io.Reader) error {
+	// Tar headers carry the entry size, which a stream does not have yet
+	return errors.New("tar archives cannot hold entries of unknown size")
+}
+
+func (t *tarArchiveWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		t.compressor.Close()
+		return err
+	}
+	return t.compressor.Close()
+}
+
+// DetectFormat returns the archive format of the file at path from its magic
+// bytes. The file name and extension are ignored.
+func DetectFormat(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, 4)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read archive header: %w", err)
+	}
+	return detectFormat(header[:n])
+}
+
+func detectFormat(header []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(header, zipMagic), bytes.HasPrefix(header, zipEmptyMagic):
+		return config.ArchiveFormatZip, nil
+	case bytes.HasPrefix(header, gzipMagic):
+		return config.ArchiveFormatTarGz, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		return config.ArchiveFormatTarZst, nil
+	default:
+		return "", fmt.Errorf("unrecognized archive format (header % x)", header)
+	}
+}
+
+// newTarReader returns a tar reader over a compressed tar stream of the given
+// format, along with the decompressed stream itself. The returned closer
+// releases the decompressor.
+func newTarReader(r io.Reader, format string) (*tar.Reader, io.Reader, func(), error) {
+	br := bufio.NewReaderSize(r, 256<<10)
+	switch format {
+	case config.ArchiveFormatTarGz:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		return tar.NewReader(gz), gz, func() { gz.Close() }, nil
+	case config.ArchiveFormatTarZst:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		return tar.NewReader(zr), zr, zr.Close, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("not a tar format: %s", format)
+	}
+}
@@ -0,0 +1,228 @@
+package compression
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+)
+
+func newArchiveSettings(t *testing.T, format string) *config.Settings {
+	tmpDir := t.TempDir()
+	settings := &config.Settings{
+		BackupArchiveFormat: format,
+		BackupTmpFolder:     filepath.Join(tmpDir, "backup"),
+		// Same file for both sides, restores must not rely on the extension
+		BackupTmpFilename:  filepath.Join(tmpDir, "archive.bin"),
+		RestoreTmpFolder:   filepath.Join(tmpDir, "restore"),
+		RestoreTmpFilename: filepath.Join(tmpDir, "archive.bin"),
+	}
+
+	files := map[string]string{
+		"dump.sql":               "CREATE TABLE test;",
+		"repositories/a/HEAD":    "ref: refs/heads/main",
+		"repositories/a/objects": "packed",
+	}
+	for name, content := range files {
+		path := filepath.Join(settings.BackupTmpFolder, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(settings.BackupTmpFolder, "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	return settings
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, format := range config.ArchiveFormats {
+		t.Run(format, func(t *testing.T) {
+			settings := newArchiveSettings(t, format)
+			settings.BackupCompressionLevel = 3
+
+			if err := CreateZip(settings, nil); err != nil {
+				t.Fatalf("CreateZip failed: %v", err)
+			}
+
+			detected, err := DetectFormat(settings.RestoreTmpFilename)
+			if err != nil {
+				t.Fatalf("DetectFormat failed: %v", err)
+			}
+			if detected != format {
+				t.Errorf("Expected format %s, detected %s", format, detected)
+			}
+
+			// A file left over by a previous restore
+			stale := filepath.Join(settings.RestoreTmpFolder, "dump.postgres.dump")
+			if err := os.MkdirAll(settings.RestoreTmpFolder, 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(stale, []byte("PGDMP"), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+
+			if err := ExtractZip(settings); err != nil {
+				t.Fatalf("ExtractZip failed: %v", err)
+			}
+
+			if _, err := os.Stat(stale); !os.IsNotExist(err) {
+				t.Errorf("Expected %s to be removed before extracting", stale)
+			}
+			content, err := os.ReadFile(filepath.Join(settings.RestoreTmpFolder, "repositories/a/HEAD"))
+			if err != nil {
+				t.Fatalf("Failed to read extracted file: %v", err)
+			}
+			if string(content) != "ref: refs/heads/main" {
+				t.Errorf("Unexpected extracted content: %q", content)
+			}
+			if info, err := os.Stat(filepath.Join(settings.RestoreTmpFolder, "empty")); err != nil || !info.IsDir() {
+				t.Errorf("Expected empty directory to be extracted, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateZip_DefaultsToZip(t *testing.T) {
+	settings := newArchiveSettings(t, "")
+
+	if err := CreateZip(settings, nil); err != nil {
+		t.Fatalf("CreateZip failed: %v", err)
+	}
+
+	format, err := DetectFormat(settings.BackupTmpFilename)
+	if err != nil {
+		t.Fatalf("DetectFormat failed: %v", err)
+	}
+	if format != config.ArchiveFormatZip {
+		t.Errorf("Expected zip archive, got %s", format)
+	}
+}
+
+func TestDetectFormat_Unknown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	if err := os.WriteFile(path, []byte("not an archive"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	if _, err := DetectFormat(path); err == nil {
+		t.Error("Expected error for unknown archive format, got nil")
+	}
+}
+
+func TestCreateZip_Manifest(t *testing.T) {
+	for _, format := range config.ArchiveFormats {
+		t.Run(format, func(t *testing.T) {
+			settings := newArchiveSettings(t, format)
+			m := manifest.New("mysql", "dump.sql")
+
+			if err := CreateZip(settings, m); err != nil {
+				t.Fatalf("CreateZip failed: %v", err)
+			}
+			if err := ExtractZip(settings); err != nil {
+				t.Fatalf("ExtractZip failed: %v", err)
+			}
+
+			read, err := manifest.Read(settings.RestoreTmpFolder)
+			if err != nil {
+				t.Fatalf("Failed to read manifest: %v", err)
+			}
+			if len(read.Files) != 3 {
+				t.Errorf("Expected 3 files in manifest, got %+v", read.Files)
+			}
+			if err := read.Verify(settings.RestoreTmpFolder); err != nil {
+				t.Errorf("Verify failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestWalkArchive(t *testing.T) {
+	for _, format := range config.ArchiveFormats {
+		t.Run(format, func(t *testing.T) {
+			settings := newArchiveSettings(t, format)
+			if err := CreateZip(settings, nil); err != nil {
+				t.Fatalf("CreateZip failed: %v", err)
+			}
+
+			contents := make(map[string]string)
+			err := WalkArchive(settings.BackupTmpFilename, func(name string, r io.Reader) error {
+				data, err := io.ReadAll(r)
+				contents[name] = string(data)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("WalkArchive failed: %v", err)
+			}
+			if len(contents) != 3 || contents["dump.sql"] != "CREATE TABLE test;" {
+				t.Errorf("Unexpected entries: %v", contents)
+			}
+		})
+	}
+}
+
+func TestWalkArchive_Corrupted(t *testing.T) {
+	for _, format := range config.ArchiveFormats {
+		t.Run(format, func(t *testing.T) {
+			settings := newArchiveSettings(t, format)
+			// Incompressible content, so a flipped byte lands in file data
+			data := make([]byte, 64<<10)
+			rand.Read(data)
+			if err := os.WriteFile(filepath.Join(settings.BackupTmpFolder, "dump.sql"), data, 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+			if err := CreateZip(settings, nil); err != nil {
+				t.Fatalf("CreateZip failed: %v", err)
+			}
+
+			archive, err := os.ReadFile(settings.BackupTmpFilename)
+			if err != nil {
+				t.Fatalf("Failed to read archive: %v", err)
+			}
+			archive[len(archive)/2] ^= 0xff
+			if err := os.WriteFile(settings.BackupTmpFilename, archive, 0644); err != nil {
+				t.Fatalf("Failed to write archive: %v", err)
+			}
+
+			// Entries are not read by the callback: the walk must still check them
+			err = WalkArchive(settings.BackupTmpFilename, func(name string, r io.Reader) error {
+				return nil
+			})
+			if err == nil {
+				t.Error("Expected error for corrupted archive, got nil")
+			}
+		})
+	}
+}
+
+func TestReadEntry(t *testing.T) {
+	for _, format := range config.ArchiveFormats {
+		t.Run(format, func(t *testing.T) {
+			settings := newArchiveSettings(t, format)
+			if err := CreateZip(settings, nil); err != nil {
+				t.Fatalf("CreateZip failed: %v", err)
+			}
+
+			data, err := ReadEntry(settings.BackupTmpFilename, "repositories/a/HEAD")
+			if err != nil {
+				t.Fatalf("ReadEntry failed: %v", err)
+			}
+			if string(data) != "ref: refs/heads/main" {
+				t.Errorf("Unexpected content: %q", data)
+			}
+
+			if _, err := ReadEntry(settings.BackupTmpFilename, "missing"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Expected os.ErrNotExist for a missing entry, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+)
+
+// Archive writes backup entries into an archive stream, in the format set by
+// BackupArchiveFormat. It is used both to build the archive from the backup
+// tmp folder and, in streaming mode, straight from the Gitea data folders.
+type Archive struct {
+	writer   archiveWriter
+	format   string
+	manifest *manifest.Manifest
+}
+
+// NewArchive returns an Archive writing to w. If m is not nil, the size and
+// SHA-256 of every file are recorded in m, which is written to the archive
+// as manifest.json on Close. Close must be called to flush the archive; it
+// does not close w.
+func NewArchive(w io.Writer, settings *config.Settings, m *manifest.Manifest) (*Archive, error) {
+	format := settings.BackupArchiveFormat
+	if format == "" {
+		format = config.ArchiveFormatZip
+	}
+
+	writer, err := newArchiveWriter(w, format, settings.BackupCompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	return &Archive{writer: writer, format: format, manifest: m}, nil
+}
+
+// Format returns the archive format being written
+func (a *Archive) Format() string {
+	return a.format
+}
+
+// AddDir adds the content of the src directory below name, or at the root of
+// the archive if name is empty
+func (a *Archive) AddDir(src, name string) error {
+	return filepath.Walk(src, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Get relative path
+		relPath, err := filepath.Rel(src, filePath)
+		if err != nil {
+			return err
+		}
+
+		// Normalize path separators for the archive
+		relPath = strings.ReplaceAll(relPath, "\\", "/")
+		entryName := path.Join(name, relPath)
+
+		// Skip the root folder itself, unless it is stored under its own name
+		if relPath == "." {
+			if name == "" {
+				return nil
+			}
+			entryName = name
+		}
+
+		if info.IsDir() {
+			return a.writer.AddDir(entryName, info.ModTime())
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		// Stat the opened file, info describes the link for symlinks
+		fileInfo, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		return a.addFile(entryName, func(r io.Reader) error {
+			return a.writer.AddFile(entryName, fileInfo.Size(), fileInfo.ModTime(), r)
+		}, file)
+	})
+}
+
+// addFile runs add with r, recording the file in the manifest
+func (a *Archive) addFile(name string, add func(r io.Reader) error, r io.Reader) error {
+	if a.manifest == nil {
+		return add(r)
+	}
+
+	hasher := manifest.NewHasher()
+	if err := add(io.TeeReader(r, hasher)); err != nil {
+		return err
+	}
+	a.manifest.Add(name, hasher.Size(), hasher.Sum())
+	return nil
+}
+
+// AddStream adds a file named name whose content is read from r until EOF.
+// Only zip archives support it: tar archives need the size of every entry
+// up front.
+func (a *Archive) AddStream(name string, r io.Reader) error {
+	if err := a.addFile(name, func(r io.Reader) error {
+		return a.writer.AddStream(name, time.Now(), r)
+	}, r); err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+	return nil
+}
+
+// Close writes the manifest, if any, and flushes the archive
+func (a *Archive) Close() error {
+	if a.manifest != nil {
+		data, err := a.manifest.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", manifest.FileName, err)
+		}
+		if err := a.writer.AddFile(manifest.FileName, int64(len(data)), time.Now(), bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", manifest.FileName, err)
+		}
+	}
+	return a.writer.Close()
+}
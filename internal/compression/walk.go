@@ -0,0 +1,151 @@
+package compression
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+// WalkArchive calls fn for every regular file of the archive at path, in
+// archive order, with a reader over its content. Directories, links and
+// special files are skipped. Whatever fn leaves unread is drained, so every
+// entry goes through the format's own integrity checks: CRC-32 for zip
+// entries, and the gzip CRC-32 or zstd checksum of the whole stream for tar
+// archives.
+func WalkArchive(path string, fn func(name string, r io.Reader) error) error {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return err
+	}
+
+	if format == config.ArchiveFormatZip {
+		return walkZipArchive(path, fn)
+	}
+	return walkTarArchive(path, format, fn)
+}
+
+func walkZipArchive(path string, fn func(name string, r io.Reader) error) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open zip file: %w", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		if err := walkZipEntry(f, fn); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func walkZipEntry(f *zip.File, fn func(name string, r io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := fn(f.Name, rc); err != nil {
+		return err
+	}
+	// archive/zip checks the CRC-32 once the entry is read to the end
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
+
+func walkTarArchive(path, format string, fn func(name string, r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s file: %w", format, err)
+	}
+	defer file.Close()
+
+	tr, stream, closeReader, err := newTarReader(file, format)
+	if err != nil {
+		return err
+	}
+	defer closeReader()
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s archive: %w", format, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(header.Name, tr); err != nil {
+			return fmt.Errorf("%s: %w", header.Name, err)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("%s: %w", header.Name, err)
+		}
+	}
+
+	// The stream checksum is only checked once the decompressor hits its end
+	if _, err := io.Copy(io.Discard, stream); err != nil {
+		return fmt.Errorf("failed to read %s archive: %w", format, err)
+	}
+	return nil
+}
+
+// ReadEntry returns the content of the regular file name of the archive at
+// path, or an error wrapping os.ErrNotExist if the archive has no such
+// entry. Unlike WalkArchive, it stops reading as soon as the entry is found.
+func ReadEntry(path, name string) ([]byte, error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == config.ArchiveFormatZip {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip file: %w", err)
+		}
+		defer zr.Close()
+
+		rc, err := zr.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s file: %w", format, err)
+	}
+	defer file.Close()
+
+	tr, _, closeReader, err := newTarReader(file, format)
+	if err != nil {
+		return nil, err
+	}
+	defer closeReader()
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("failed to read %s: %w", name, os.ErrNotExist)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s archive: %w", format, err)
+		}
+		if header.Typeflag == tar.TypeReg && header.Name == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
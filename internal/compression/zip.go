@@ -1,6 +1,7 @@
 package compression
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"fmt"
 	"io"
@@ -10,68 +11,39 @@ import (
 	"sync"
 
 	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
 	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
 )
 
-// CreateZip creates a zip archive from the backup tmp folder
-func CreateZip(settings *config.Settings) error {
-	logger.Info("Creating zip archive")
+// CreateZip creates an archive from the backup tmp folder, in the format set by
+// BackupArchiveFormat (zip, tar.gz or tar.zst). If m is not nil, it is
+// filled in and embedded in the archive as manifest.json.
+func CreateZip(settings *config.Settings, m *manifest.Manifest) error {
+	archiveFile, err := os.Create(settings.BackupTmpFilename)
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer archiveFile.Close()
 	
-	zipFile, err := os.Create(settings.BackupTmpFilename)
+	archive, err := NewArchive(archiveFile, settings, m)
 	if err != nil {
-		return fmt.Errorf("failed to create zip file: %w", err)
+		return err
 	}
-	defer zipFile.Close()
+	logger.Infof("Creating %s archive", archive.Format())
 	
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	if err := archive.AddDir(settings.BackupTmpFolder, ""); err != nil {
+		return fmt.Errorf("failed to create %s archive: %w", archive.Format(), err)
+	}
 	
-	err = filepath.Walk(settings.BackupTmpFolder, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		
-		// Skip the root folder itself
-		if path == settings.BackupTmpFolder {
-			return nil
-		}
-		
-		// Get relative path
-		relPath, err := filepath.Rel(settings.BackupTmpFolder, path)
-		if err != nil {
-			return err
-		}
-		
-		// Normalize path separators for zip
-		relPath = strings.ReplaceAll(relPath, "\\", "/")
-		
-		if info.IsDir() {
-			// Add directory to zip (with trailing slash)
-			_, err := zipWriter.Create(relPath + "/")
-			return err
-		}
-		
-		// Add file to zip
-		fileWriter, err := zipWriter.Create(relPath)
-		if err != nil {
-			return err
-		}
-		
-		file, err := os.Open(path)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-		
-		_, err = io.Copy(fileWriter, file)
-		return err
-	})
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finalize %s archive: %w", archive.Format(), err)
+	}
 	
-	if err != nil {
-		return fmt.Errorf("failed to create zip archive: %w", err)
+	if err := archiveFile.Close(); err != nil {
+		return fmt.Errorf("failed to close archive file: %w", err)
 	}
 	
-	logger.Info("Zip archive created successfully")
+	logger.Infof("%s archive created successfully", archive.Format())
 	return nil
 }
 
@@ -82,15 +54,27 @@ const (
 
 var copyBufPool = sync.Pool{
 	New: func() any {
-		// 256 KiB buffer tends to perform well for zip streams
+		// 256 KiB buffer tends to perform well for archive streams
 		buf := make([]byte, 256<<10)
 		return buf
 	},
 }
 
-// ExtractZip extracts a zip archive to the restore tmp folder with rwx perms.
+// ExtractZip extracts a backup archive to the restore tmp folder with rwx perms.
+// The archive format (zip, tar.gz or tar.zst) is detected from its magic bytes.
+// Anything already in the folder is removed first.
 func ExtractZip(settings *config.Settings) error {
-	logger.Info("Extracting zip archive")
+	format, err := DetectFormat(settings.RestoreTmpFilename)
+	if err != nil {
+		return fmt.Errorf("failed to detect archive format: %w", err)
+	}
+	logger.Infof("Extracting %s archive", format)
+
+	// Start from an empty folder, so that it only holds the files of this
+	// archive and nothing left over by a previous restore
+	if err := os.RemoveAll(settings.RestoreTmpFolder); err != nil {
+		return fmt.Errorf("failed to clean restore tmp folder: %w", err)
+	}
 
 	// Ensure destination root exists with rwx
 	if err := os.MkdirAll(settings.RestoreTmpFolder, dirPerm); err != nil {
@@ -98,49 +82,81 @@ func ExtractZip(settings *config.Settings) error {
 	}
 	_ = os.Chmod(settings.RestoreTmpFolder, dirPerm)
 
-	zr, err := zip.OpenReader(settings.RestoreTmpFilename)
+	base := filepath.Clean(settings.RestoreTmpFolder)
+	if format == config.ArchiveFormatZip {
+		err = extractZipArchive(settings.RestoreTmpFilename, base)
+	} else {
+		err = extractTarArchive(settings.RestoreTmpFilename, format, base)
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("%s archive extracted successfully", format)
+	return nil
+}
+
+func extractZipArchive(path, base string) error {
+	zr, err := zip.OpenReader(path)
 	if err != nil {
 		return fmt.Errorf("failed to open zip file: %w", err)
 	}
 	defer zr.Close()
 
-	base := filepath.Clean(settings.RestoreTmpFolder)
 	for _, f := range zr.File {
 		if err := extractFileRWX(f, base); err != nil {
 			return fmt.Errorf("failed to extract %s: %w", f.Name, err)
 		}
 	}
-
-	logger.Info("Zip archive extracted successfully")
 	return nil
 }
 
-func extractFileRWX(f *zip.File, destDir string) error {
-	// Zip Slip prevention
-	dest := filepath.Join(destDir, f.Name)
-	if !strings.HasPrefix(dest, destDir+string(os.PathSeparator)) {
-		return fmt.Errorf("invalid file path: %s", f.Name)
+func extractTarArchive(path, format, base string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s file: %w", format, err)
 	}
+	defer file.Close()
 
-	mode := f.Mode()
+	tr, _, closeReader, err := newTarReader(file, format)
+	if err != nil {
+		return err
+	}
+	defer closeReader()
 
-	// Directories
-	if f.FileInfo().IsDir() {
-		if err := os.MkdirAll(dest, dirPerm); err != nil {
-			return err
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s archive: %w", format, err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = extractEntryRWX(header.Name, true, nil, base)
+		case tar.TypeReg:
+			err = extractEntryRWX(header.Name, false, tr, base)
+		default:
+			// Skip links and special files (safer default), as for zip
+			logger.Debugf("Skipping non-regular entry from archive: %s", header.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", header.Name, err)
 		}
-		return os.Chmod(dest, dirPerm)
 	}
+}
 
+func extractFileRWX(f *zip.File, destDir string) error {
 	// Skip symlinks (safer default). If you need them, validate target then os.Symlink.
-	if mode&os.ModeSymlink != 0 {
+	if f.Mode()&os.ModeSymlink != 0 {
 		logger.Debugf("Skipping symlink from zip: %s", f.Name)
 		return nil
 	}
 
-	// Ensure parent dir exists (with rwx)
-	if err := os.MkdirAll(filepath.Dir(dest), dirPerm); err != nil {
-		return err
+	if f.FileInfo().IsDir() {
+		return extractEntryRWX(f.Name, true, nil, destDir)
 	}
 
 	rc, err := f.Open()
@@ -149,13 +165,38 @@ func extractFileRWX(f *zip.File, destDir string) error {
 	}
 	defer rc.Close()
 
+	return extractEntryRWX(f.Name, false, rc, destDir)
+}
+
+// extractEntryRWX writes one archive entry below destDir, reading file
+// content from r
+func extractEntryRWX(name string, isDir bool, r io.Reader, destDir string) error {
+	// Zip Slip prevention
+	dest := filepath.Join(destDir, name)
+	if !strings.HasPrefix(dest, destDir+string(os.PathSeparator)) {
+		return fmt.Errorf("invalid file path: %s", name)
+	}
+
+	// Directories
+	if isDir {
+		if err := os.MkdirAll(dest, dirPerm); err != nil {
+			return err
+		}
+		return os.Chmod(dest, dirPerm)
+	}
+
+	// Ensure parent dir exists (with rwx)
+	if err := os.MkdirAll(filepath.Dir(dest), dirPerm); err != nil {
+		return err
+	}
+
 	// Create file; set perms after write to override umask
 	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
 	if err != nil {
 		return err
 	}
 	buf := copyBufPool.Get().([]byte)
-	_, cpErr := io.CopyBuffer(out, rc, buf)
+	_, cpErr := io.CopyBuffer(out, r, buf)
 	putErr := out.Close()
 	copyBufPool.Put(buf)
 	if cpErr != nil {
@@ -167,4 +208,4 @@ func extractFileRWX(f *zip.File, destDir string) error {
 
 	// Force desired perms (ensures rwx even if umask interfered)
 	return os.Chmod(dest, filePerm)
-}
\ No newline at end of file
+}
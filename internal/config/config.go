@@ -3,45 +3,151 @@ package config
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
 )
 
 // Settings represents the configuration for gitea backup/restore
 type Settings struct {
-	BackupEnable             bool   `yaml:"backup_enable"`
-	BackupMethod             string `yaml:"backup_method"`
-	BackupFilename           string `yaml:"backup_filename,omitempty"`
-	BackupFileLog            string `yaml:"backup_file_log"`
-	BackupTmpRemoteFilename  string `yaml:"backup_tmp_remote_filename"`
-	BackupPrefix             string `yaml:"backup_prefix"`
-	BackupMaxRetention       int    `yaml:"backup_max_retention"`
-	BackupTmpFolder          string `yaml:"backup_tmp_folder"`
-	BackupTmpFilename        string `yaml:"backup_tmp_filename"`
-	RestoreTmpFolder         string `yaml:"restore_tmp_folder"`
-	RestoreTmpFilename       string `yaml:"restore_tmp_filename"`
-	AppIniPath               string `yaml:"app_ini_path"`
-	giteaUser                string `yaml:"gitea_user"`
+	BackupEnable             bool          `yaml:"backup_enable"`
+	BackupMethod             string        `yaml:"backup_method"`
+	BackupFilename           string        `yaml:"backup_filename,omitempty"`
+	BackupFileLog            string        `yaml:"backup_file_log"`
+	BackupTmpRemoteFilename  string        `yaml:"backup_tmp_remote_filename"`
+	BackupPrefix             string        `yaml:"backup_prefix"`
+	BackupMaxRetention       int           `yaml:"backup_max_retention"`
+	BackupKeepDaily          int           `yaml:"backup_keep_daily"`
+	BackupKeepWeekly         int           `yaml:"backup_keep_weekly"`
+	BackupKeepMonthly        int           `yaml:"backup_keep_monthly"`
+	BackupKeepYearly         int           `yaml:"backup_keep_yearly"`
+	BackupMaxAge             time.Duration `yaml:"backup_max_age"`
+	BackupMaxTotalSize       int64         `yaml:"backup_max_total_size"`
+	BackupRetentionDryRun    bool          `yaml:"backup_retention_dry_run"`
+	BackupArchiveFormat      string        `yaml:"backup_archive_format"`
+	BackupCompressionLevel   int           `yaml:"backup_compression_level"`
+	BackupStreaming          bool          `yaml:"backup_streaming"`
+	PostgresDumpFormat       string        `yaml:"postgres_dump_format"`
+	PostgresJobs             int           `yaml:"postgres_jobs"`
+	MySQLDumpRoutines        bool          `yaml:"mysql_dump_routines"`
+	MSSQLTrustServerCert     bool          `yaml:"mssql_trust_server_certificate"`
+	EncryptionRecipients     []string      `yaml:"encryption_recipients"`
+	EncryptionIdentityFile   string        `yaml:"encryption_identity_file"`
+	EncryptionPassphrase     string        `yaml:"encryption_passphrase"`
+	SigningKeyFile           string        `yaml:"signing_key_file"`
+	SigningPublicKeyFile     string        `yaml:"signing_public_key_file"`
+	BackupTmpFolder          string        `yaml:"backup_tmp_folder"`
+	BackupTmpFilename        string        `yaml:"backup_tmp_filename"`
+	RestoreTmpFolder         string        `yaml:"restore_tmp_folder"`
+	RestoreTmpFilename       string        `yaml:"restore_tmp_filename"`
+	AppIniPath               string        `yaml:"app_ini_path"`
+	LogLevel                 string        `yaml:"log_level"`
+	LogFormat                string        `yaml:"log_format"`
+	giteaUser                string        `yaml:"gitea_user"`
+
+	// remoteFilenameTemplate keeps BackupTmpRemoteFilename before placeholder
+	// replacement so that backup times can be parsed back from remote names
+	remoteFilenameTemplate string
+	// fileValues holds the values of the configuration file, keyed by
+	// environment variable, for the settings read through Getenv
+	fileValues map[string]string
 }
 
+const (
+	// DefaultRemoteFilenameTemplate is the default value of BackupTmpRemoteFilename
+	DefaultRemoteFilenameTemplate = "@prefix-@date.@ext"
+
+	// BackupDateFormat is the layout used for the @date placeholder
+	BackupDateFormat = "2006-01-02-15-04-05"
+)
+
+// Supported archive formats
+const (
+	ArchiveFormatZip    = "zip"
+	ArchiveFormatTarGz  = "tar.gz"
+	ArchiveFormatTarZst = "tar.zst"
+)
+
+// ArchiveFormats lists the supported values of BackupArchiveFormat
+var ArchiveFormats = []string{ArchiveFormatZip, ArchiveFormatTarGz, ArchiveFormatTarZst}
+
+// Supported pg_dump formats
+const (
+	PostgresFormatPlain     = "plain"
+	PostgresFormatCustom    = "custom"
+	PostgresFormatDirectory = "directory"
+)
+
+// PostgresDumpFormats lists the supported values of PostgresDumpFormat
+var PostgresDumpFormats = []string{PostgresFormatPlain, PostgresFormatCustom, PostgresFormatDirectory}
+
 // NewSettings creates a new Settings instance with default values and environment overrides
 func NewSettings() (*Settings, error) {
+	return NewSettingsWithOverrides(nil)
+}
+
+// NewSettingsWithOverrides creates a new Settings instance like NewSettings,
+// with overrides taking precedence over the environment. overrides maps
+// environment variable names to values, as collected by RegisterFlags.
+//
+// When BACKUP_CONFIG_FILE names a YAML configuration file, its values sit
+// between the defaults and the environment.
+func NewSettingsWithOverrides(overrides map[string]string) (*Settings, error) {
 	settings := &Settings{
 		BackupFileLog:           "/data/gitea/backupFileLog.txt",
-		BackupTmpRemoteFilename: "@prefix-@date.zip",
+		BackupTmpRemoteFilename: DefaultRemoteFilenameTemplate,
 		BackupPrefix:            "gitea-backup",
 		BackupMaxRetention:      5,
+		BackupArchiveFormat:     ArchiveFormatZip,
+		PostgresDumpFormat:      PostgresFormatPlain,
+		PostgresJobs:            1,
 		BackupTmpFolder:         "/tmp/backup",
 		BackupTmpFilename:       "/tmp/backup.zip",
 		RestoreTmpFolder:        "/tmp/restore",
 		RestoreTmpFilename:      "/tmp/restore.zip",
 		AppIniPath:              "/data/gitea/conf/app.ini",
+		LogLevel:                "info",
+		LogFormat:               logger.FormatText,
 		giteaUser:               "git",
 	}
 
+	lookup := func(name string) string {
+		if val, ok := overrides[name]; ok {
+			return val
+		}
+		return os.Getenv(name)
+	}
+	
+	// Load the configuration file, which the environment takes precedence over
+	if path := lookup(ConfigFileEnv); path != "" {
+		values, err := LoadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		settings.fileValues = values
+	}
+	
 	// Load from environment variables
-	if err := settings.loadFromEnv(); err != nil {
+	getenv := func(name string) string {
+		if val := lookup(name); val != "" {
+			return val
+		}
+		// The legacy spelling set in the environment still beats the file
+		if name == "BACKUP_METHOD" {
+			if val := lookup("BACKUP_METHODE"); val != "" {
+				return val
+			}
+		}
+		return settings.fileValue(name)
+	}
+	// Secrets come whole from the first of these that sets them, so that a
+	// _FILE variable can replace a value written in the file
+	flag := func(name string) string { return overrides[name] }
+	secretSources := []func(name string) string{flag, os.Getenv, settings.fileValue}
+	if err := settings.loadFromEnv(getenv, secretSources); err != nil {
 		return nil, err
 	}
 
@@ -56,8 +162,8 @@ func NewSettings() (*Settings, error) {
 	return settings, nil
 }
 
-func (s *Settings) loadFromEnv() error {
-	if val := os.Getenv("BACKUP_ENABLE"); val != "" {
+func (s *Settings) loadFromEnv(getenv func(name string) string, secretSources []func(name string) string) error {
+	if val := getenv("BACKUP_ENABLE"); val != "" {
 		enable, err := strconv.ParseBool(val)
 		if err != nil {
 			return fmt.Errorf("invalid BACKUP_ENABLE: %w", err)
@@ -65,30 +171,30 @@ func (s *Settings) loadFromEnv() error {
 		s.BackupEnable = enable
 	}
 
-	if val := os.Getenv("BACKUP_METHODE"); val != "" { // Keep original typo for compatibility
+	if val := getenv("BACKUP_METHODE"); val != "" { // Keep original typo for compatibility
 		s.BackupMethod = val
 	}
-	if val := os.Getenv("BACKUP_METHOD"); val != "" { // Also support correct spelling
+	if val := getenv("BACKUP_METHOD"); val != "" { // Also support correct spelling
 		s.BackupMethod = val
 	}
 
-	if val := os.Getenv("BACKUP_FILENAME"); val != "" {
+	if val := getenv("BACKUP_FILENAME"); val != "" {
 		s.BackupFilename = val
 	}
 
-	if val := os.Getenv("BACKUP_FILE_LOG"); val != "" {
+	if val := getenv("BACKUP_FILE_LOG"); val != "" {
 		s.BackupFileLog = val
 	}
 
-	if val := os.Getenv("BACKUP_TMP_REMOTE_FILENAME"); val != "" {
+	if val := getenv("BACKUP_TMP_REMOTE_FILENAME"); val != "" {
 		s.BackupTmpRemoteFilename = val
 	}
 
-	if val := os.Getenv("BACKUP_PREFIX"); val != "" {
+	if val := getenv("BACKUP_PREFIX"); val != "" {
 		s.BackupPrefix = val
 	}
 
-	if val := os.Getenv("BACKUP_MAX_RETENTION"); val != "" {
+	if val := getenv("BACKUP_MAX_RETENTION"); val != "" {
 		retention, err := strconv.Atoi(val)
 		if err != nil {
 			return fmt.Errorf("invalid BACKUP_MAX_RETENTION: %w", err)
@@ -96,27 +202,149 @@ func (s *Settings) loadFromEnv() error {
 		s.BackupMaxRetention = retention
 	}
 
-	if val := os.Getenv("BACKUP_TMP_FOLDER"); val != "" {
+	keepVars := map[string]*int{
+		"BACKUP_KEEP_DAILY":   &s.BackupKeepDaily,
+		"BACKUP_KEEP_WEEKLY":  &s.BackupKeepWeekly,
+		"BACKUP_KEEP_MONTHLY": &s.BackupKeepMonthly,
+		"BACKUP_KEEP_YEARLY":  &s.BackupKeepYearly,
+	}
+	for name, field := range keepVars {
+		if val := getenv(name); val != "" {
+			keep, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*field = keep
+		}
+	}
+
+	if val := getenv("BACKUP_MAX_AGE"); val != "" {
+		maxAge, err := ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid BACKUP_MAX_AGE: %w", err)
+		}
+		s.BackupMaxAge = maxAge
+	}
+
+	if val := getenv("BACKUP_MAX_TOTAL_SIZE"); val != "" {
+		maxTotalSize, err := ParseSize(val)
+		if err != nil {
+			return fmt.Errorf("invalid BACKUP_MAX_TOTAL_SIZE: %w", err)
+		}
+		s.BackupMaxTotalSize = maxTotalSize
+	}
+
+	if val := getenv("BACKUP_RETENTION_DRY_RUN"); val != "" {
+		dryRun, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid BACKUP_RETENTION_DRY_RUN: %w", err)
+		}
+		s.BackupRetentionDryRun = dryRun
+	}
+
+	if val := getenv("BACKUP_ARCHIVE_FORMAT"); val != "" {
+		s.BackupArchiveFormat = val
+	}
+
+	if val := getenv("BACKUP_COMPRESSION_LEVEL"); val != "" {
+		level, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("invalid BACKUP_COMPRESSION_LEVEL: %w", err)
+		}
+		s.BackupCompressionLevel = level
+	}
+
+	if val := getenv("BACKUP_STREAMING"); val != "" {
+		streaming, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid BACKUP_STREAMING: %w", err)
+		}
+		s.BackupStreaming = streaming
+	}
+
+	if val := getenv("POSTGRES_DUMP_FORMAT"); val != "" {
+		s.PostgresDumpFormat = val
+	}
+
+	if val := getenv("POSTGRES_JOBS"); val != "" {
+		jobs, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("invalid POSTGRES_JOBS: %w", err)
+		}
+		s.PostgresJobs = jobs
+	}
+
+	if val := getenv("MYSQL_DUMP_ROUTINES"); val != "" {
+		routines, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid MYSQL_DUMP_ROUTINES: %w", err)
+		}
+		s.MySQLDumpRoutines = routines
+	}
+
+	if val := getenv("MSSQL_TRUST_SERVER_CERTIFICATE"); val != "" {
+		trust, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid MSSQL_TRUST_SERVER_CERTIFICATE: %w", err)
+		}
+		s.MSSQLTrustServerCert = trust
+	}
+
+	if val := getenv("BACKUP_ENCRYPTION_RECIPIENTS"); val != "" {
+		s.EncryptionRecipients = strings.FieldsFunc(val, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\n'
+		})
+	}
+
+	if val := getenv("BACKUP_ENCRYPTION_IDENTITY_FILE"); val != "" {
+		s.EncryptionIdentityFile = val
+	}
+
+	passphrase, err := readSecret("BACKUP_ENCRYPTION_PASSPHRASE", secretSources...)
+	if err != nil {
+		return err
+	}
+	if passphrase != "" {
+		s.EncryptionPassphrase = passphrase
+	}
+
+	if val := getenv("BACKUP_SIGNING_KEY_FILE"); val != "" {
+		s.SigningKeyFile = val
+	}
+
+	if val := getenv("BACKUP_SIGNING_PUBLIC_KEY_FILE"); val != "" {
+		s.SigningPublicKeyFile = val
+	}
+
+	if val := getenv("BACKUP_TMP_FOLDER"); val != "" {
 		s.BackupTmpFolder = val
 	}
 
-	if val := os.Getenv("BACKUP_TMP_FILENAME"); val != "" {
+	if val := getenv("BACKUP_TMP_FILENAME"); val != "" {
 		s.BackupTmpFilename = val
 	}
 
-	if val := os.Getenv("RESTORE_TMP_FOLDER"); val != "" {
+	if val := getenv("RESTORE_TMP_FOLDER"); val != "" {
 		s.RestoreTmpFolder = val
 	}
 
-	if val := os.Getenv("RESTORE_TMP_FILENAME"); val != "" {
+	if val := getenv("RESTORE_TMP_FILENAME"); val != "" {
 		s.RestoreTmpFilename = val
 	}
 
-	if val := os.Getenv("APP_INI_PATH"); val != "" {
+	if val := getenv("APP_INI_PATH"); val != "" {
 		s.AppIniPath = val
 	}
 
-	if val := os.Getenv("GITEA_USER"); val != "" {
+	if val := getenv("LOG_LEVEL"); val != "" {
+		s.LogLevel = val
+	}
+
+	if val := getenv("LOG_FORMAT"); val != "" {
+		s.LogFormat = val
+	}
+
+	if val := getenv("GITEA_USER"); val != "" {
 		s.giteaUser = val
 	}
 
@@ -126,15 +354,53 @@ func (s *Settings) loadFromEnv() error {
 func (s *Settings) processTemplates() {
 	// Replace template placeholders in backup filename
 	now := time.Now()
-	dateStr := now.Format("2006-01-02-15-04-05")
+	dateStr := now.Format(BackupDateFormat)
 	
+	s.remoteFilenameTemplate = s.BackupTmpRemoteFilename
 	s.BackupTmpRemoteFilename = strings.ReplaceAll(s.BackupTmpRemoteFilename, "@prefix", s.BackupPrefix)
 	s.BackupTmpRemoteFilename = strings.ReplaceAll(s.BackupTmpRemoteFilename, "@date", dateStr)
+	s.BackupTmpRemoteFilename = strings.ReplaceAll(s.BackupTmpRemoteFilename, "@ext", s.BackupArchiveFormat)
+}
+
+// BackupTime extracts the backup date from a remote filename generated from the
+// BackupTmpRemoteFilename template. ok is false if the name does not match the
+// template or the template has no @date placeholder.
+func (s *Settings) BackupTime(name string) (t time.Time, ok bool) {
+	template := s.remoteFilenameTemplate
+	if template == "" {
+		template = DefaultRemoteFilenameTemplate
+	}
+	if !strings.Contains(template, "@date") {
+		return time.Time{}, false
+	}
+	
+	pattern := regexp.QuoteMeta(template)
+	pattern = strings.ReplaceAll(pattern, "@prefix", regexp.QuoteMeta(s.BackupPrefix))
+	pattern = strings.Replace(pattern, "@date", `(\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2})`, 1)
+	pattern = strings.ReplaceAll(pattern, "@date", `\d{4}-\d{2}-\d{2}-\d{2}-\d{2}-\d{2}`)
+	// Match every format so that backups taken before a format change still count
+	pattern = strings.ReplaceAll(pattern, "@ext", `(?:zip|tar\.gz|tar\.zst)`)
+	
+	re, err := regexp.Compile("^" + pattern + "$")
+	if err != nil {
+		return time.Time{}, false
+	}
+	
+	match := re.FindStringSubmatch(name)
+	if match == nil {
+		return time.Time{}, false
+	}
+	
+	t, err = time.ParseInLocation(BackupDateFormat, match[1], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
 }
 
 func (s *Settings) validate() error {
 	// Validate backup method
-	supportedMethods := []string{"s3", "ftp"}
+	supportedMethods := []string{"s3", "ftp", "sftp", "local"}
 	validMethod := false
 	for _, method := range supportedMethods {
 		if s.BackupMethod == method {
@@ -146,9 +412,63 @@ func (s *Settings) validate() error {
 		return fmt.Errorf("invalid backup method '%s', supported methods: %v", s.BackupMethod, supportedMethods)
 	}
 
+	// Validate archive format and compression level
+	maxLevel := 0
+	switch s.BackupArchiveFormat {
+	case ArchiveFormatZip, ArchiveFormatTarGz:
+		maxLevel = 9
+	case ArchiveFormatTarZst:
+		maxLevel = 22
+	default:
+		return fmt.Errorf("invalid archive format '%s', supported formats: %v", s.BackupArchiveFormat, ArchiveFormats)
+	}
+	if s.BackupCompressionLevel < 0 || s.BackupCompressionLevel > maxLevel {
+		return fmt.Errorf("invalid compression level %d for %s, expected 1-%d (0 for the default)", s.BackupCompressionLevel, s.BackupArchiveFormat, maxLevel)
+	}
+
+	// tar headers carry the size of their entry, which streamed dumps only
+	// know once they end, so tar archives would have to spool them to disk
+	if s.BackupStreaming && s.BackupArchiveFormat != ArchiveFormatZip {
+		return fmt.Errorf("streaming backups require the %s archive format, %s entries need their size before their data", ArchiveFormatZip, s.BackupArchiveFormat)
+	}
+
+	// Validate PostgreSQL dump options
+	switch s.PostgresDumpFormat {
+	case PostgresFormatPlain, PostgresFormatCustom, PostgresFormatDirectory:
+	default:
+		return fmt.Errorf("invalid PostgreSQL dump format '%s', supported formats: %v", s.PostgresDumpFormat, PostgresDumpFormats)
+	}
+	if s.PostgresJobs < 1 {
+		return fmt.Errorf("invalid PostgreSQL jobs %d, expected at least 1", s.PostgresJobs)
+	}
+
+	// Validate logging
+	if _, err := logger.ParseLevel(s.LogLevel); err != nil {
+		return err
+	}
+	if s.LogFormat != logger.FormatText && s.LogFormat != logger.FormatJSON {
+		return fmt.Errorf("invalid log format '%s', expected %s or %s", s.LogFormat, logger.FormatText, logger.FormatJSON)
+	}
+
+	// Only one encryption method can be used for new backups
+	if len(s.EncryptionRecipients) > 0 && s.EncryptionPassphrase != "" {
+		return fmt.Errorf("BACKUP_ENCRYPTION_RECIPIENTS and BACKUP_ENCRYPTION_PASSPHRASE cannot be used together")
+	}
+
 	return nil
 }
 
+// String formats the settings for logs, with secrets redacted
+func (s Settings) String() string {
+	// settingsFields has the fields of Settings without its methods, so that
+	// formatting it does not call String again
+	type settingsFields Settings
+	s.EncryptionPassphrase = logger.Redact(s.EncryptionPassphrase)
+	// The configuration file values hold the storage credentials
+	s.fileValues = nil
+	return fmt.Sprintf("%+v", settingsFields(s))
+}
+
 // GiteaConfig represents Gitea's app.ini configuration
 type GiteaConfig struct {
 	Database   DatabaseConfig   `ini:"database"`
@@ -156,13 +476,22 @@ type GiteaConfig struct {
 	Picture    PictureConfig    `ini:"picture"`
 }
 
+// String formats the Gitea configuration for logs, with the database
+// password redacted
+func (c GiteaConfig) String() string {
+	type giteaConfigFields GiteaConfig
+	c.Database.Passwd = logger.Redact(c.Database.Passwd)
+	return fmt.Sprintf("%+v", giteaConfigFields(c))
+}
+
 type DatabaseConfig struct {
-	DBType string `ini:"DB_TYPE"`
-	Host   string `ini:"HOST"`
-	Name   string `ini:"NAME"`
-	User   string `ini:"USER"`
-	Passwd string `ini:"PASSWD"`
-	Path   string `ini:"PATH"` // For SQLite
+	DBType  string `ini:"DB_TYPE"`
+	Host    string `ini:"HOST"`
+	Name    string `ini:"NAME"`
+	User    string `ini:"USER"`
+	Passwd  string `ini:"PASSWD"`
+	Charset string `ini:"CHARSET"` // For MySQL
+	Path    string `ini:"PATH"`    // For SQLite
 }
 
 type RepositoryConfig struct {
@@ -1,8 +1,11 @@
 package config_test
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Frantche/gitea-backup-restore-process/internal/config"
 )
@@ -126,6 +129,28 @@ func clearEnvVars() {
 		"BACKUP_PREFIX",
 		"BACKUP_MAX_RETENTION",
 		"BACKUP_TMP_REMOTE_FILENAME",
+		"BACKUP_KEEP_DAILY",
+		"BACKUP_KEEP_WEEKLY",
+		"BACKUP_KEEP_MONTHLY",
+		"BACKUP_KEEP_YEARLY",
+		"BACKUP_MAX_AGE",
+		"BACKUP_MAX_TOTAL_SIZE",
+		"BACKUP_RETENTION_DRY_RUN",
+		"BACKUP_ARCHIVE_FORMAT",
+		"BACKUP_COMPRESSION_LEVEL",
+		"BACKUP_STREAMING",
+		"POSTGRES_DUMP_FORMAT",
+		"POSTGRES_JOBS",
+		"MYSQL_DUMP_ROUTINES",
+		"MSSQL_TRUST_SERVER_CERTIFICATE",
+		"BACKUP_ENCRYPTION_RECIPIENTS",
+		"BACKUP_ENCRYPTION_IDENTITY_FILE",
+		"BACKUP_ENCRYPTION_PASSPHRASE",
+		"BACKUP_SIGNING_KEY_FILE",
+		"BACKUP_SIGNING_PUBLIC_KEY_FILE",
+		"BACKUP_CONFIG_FILE",
+		"LOG_LEVEL",
+		"LOG_FORMAT",
 	}
 	
 	for _, env := range envVars {
@@ -148,4 +173,345 @@ func findSubstring(s, substr string) bool {
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
+func TestNewSettings_KeepRules(t *testing.T) {
+	clearEnvVars()
+	
+	os.Setenv("BACKUP_METHODE", "s3")
+	os.Setenv("BACKUP_KEEP_DAILY", "7")
+	os.Setenv("BACKUP_KEEP_WEEKLY", "4")
+	os.Setenv("BACKUP_KEEP_MONTHLY", "12")
+	os.Setenv("BACKUP_KEEP_YEARLY", "3")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	if settings.BackupKeepDaily != 7 || settings.BackupKeepWeekly != 4 ||
+		settings.BackupKeepMonthly != 12 || settings.BackupKeepYearly != 3 {
+		t.Errorf("Unexpected keep rules: daily=%d weekly=%d monthly=%d yearly=%d",
+			settings.BackupKeepDaily, settings.BackupKeepWeekly, settings.BackupKeepMonthly, settings.BackupKeepYearly)
+	}
+	
+	os.Setenv("BACKUP_KEEP_WEEKLY", "often")
+	if _, err := config.NewSettings(); err == nil {
+		t.Error("Expected error for invalid BACKUP_KEEP_WEEKLY, got nil")
+	}
+}
+
+func TestSettings_BackupTime(t *testing.T) {
+	clearEnvVars()
+	
+	os.Setenv("BACKUP_METHODE", "s3")
+	os.Setenv("BACKUP_PREFIX", "my.backup")
+	os.Setenv("BACKUP_TMP_REMOTE_FILENAME", "gitea/@prefix_@date.zip")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	backupTime, ok := settings.BackupTime(settings.BackupTmpRemoteFilename)
+	if !ok {
+		t.Fatalf("Expected to parse the time of %s", settings.BackupTmpRemoteFilename)
+	}
+	if time.Since(backupTime) > time.Minute {
+		t.Errorf("Expected the parsed time to be now, got %v", backupTime)
+	}
+	
+	expected := time.Date(2024, 2, 29, 23, 15, 30, 0, time.Local)
+	backupTime, ok = settings.BackupTime("gitea/my.backup_2024-02-29-23-15-30.zip")
+	if !ok || !backupTime.Equal(expected) {
+		t.Errorf("Expected %v, got %v (ok=%v)", expected, backupTime, ok)
+	}
+	
+	for _, name := range []string{
+		"gitea/myxbackup_2024-02-29-23-15-30.zip",
+		"gitea/my.backup_2024-02-29.zip",
+		"other.zip",
+	} {
+		if _, ok := settings.BackupTime(name); ok {
+			t.Errorf("Expected %s not to match the template", name)
+		}
+	}
+}
+
+func TestNewSettings_MaxAgeAndTotalSize(t *testing.T) {
+	clearEnvVars()
+	
+	os.Setenv("BACKUP_METHODE", "s3")
+	os.Setenv("BACKUP_MAX_AGE", "90d")
+	os.Setenv("BACKUP_MAX_TOTAL_SIZE", "50GiB")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	
+	if settings.BackupMaxAge != 90*24*time.Hour {
+		t.Errorf("Expected BackupMaxAge to be 90 days, got %v", settings.BackupMaxAge)
+	}
+	if settings.BackupMaxTotalSize != 50<<30 {
+		t.Errorf("Expected BackupMaxTotalSize to be 50GiB, got %d", settings.BackupMaxTotalSize)
+	}
+	
+	os.Setenv("BACKUP_MAX_TOTAL_SIZE", "a lot")
+	if _, err := config.NewSettings(); err == nil {
+		t.Error("Expected error for invalid BACKUP_MAX_TOTAL_SIZE, got nil")
+	}
+}
+
+func TestNewSettings_RetentionDryRun(t *testing.T) {
+	clearEnvVars()
+	
+	os.Setenv("BACKUP_METHODE", "s3")
+	os.Setenv("BACKUP_RETENTION_DRY_RUN", "true")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !settings.BackupRetentionDryRun {
+		t.Error("Expected BackupRetentionDryRun to be true")
+	}
+	
+	os.Setenv("BACKUP_RETENTION_DRY_RUN", "maybe")
+	if _, err := config.NewSettings(); err == nil {
+		t.Error("Expected error for invalid BACKUP_RETENTION_DRY_RUN, got nil")
+	}
+}
+
+func TestNewSettings_Streaming(t *testing.T) {
+	clearEnvVars()
+	
+	os.Setenv("BACKUP_METHODE", "s3")
+	os.Setenv("BACKUP_STREAMING", "true")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !settings.BackupStreaming {
+		t.Error("Expected BackupStreaming to be true")
+	}
+	
+	os.Setenv("BACKUP_STREAMING", "sometimes")
+	if _, err := config.NewSettings(); err == nil {
+		t.Error("Expected error for invalid BACKUP_STREAMING, got nil")
+	}
+	
+	// tar archives cannot take dumps of unknown size without spooling them
+	os.Setenv("BACKUP_STREAMING", "true")
+	os.Setenv("BACKUP_ARCHIVE_FORMAT", "tar.zst")
+	if _, err := config.NewSettings(); err == nil {
+		t.Error("Expected error for streaming to a tar.zst archive, got nil")
+	}
+}
+
+func TestNewSettings_ArchiveFormat(t *testing.T) {
+	clearEnvVars()
+	
+	os.Setenv("BACKUP_METHODE", "s3")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.BackupArchiveFormat != config.ArchiveFormatZip {
+		t.Errorf("Expected default archive format zip, got %s", settings.BackupArchiveFormat)
+	}
+	if !contains(settings.BackupTmpRemoteFilename, ".zip") {
+		t.Errorf("Expected remote filename to end with .zip, got %s", settings.BackupTmpRemoteFilename)
+	}
+	
+	os.Setenv("BACKUP_ARCHIVE_FORMAT", "tar.zst")
+	os.Setenv("BACKUP_COMPRESSION_LEVEL", "19")
+	settings, err = config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.BackupCompressionLevel != 19 {
+		t.Errorf("Expected compression level 19, got %d", settings.BackupCompressionLevel)
+	}
+	if !contains(settings.BackupTmpRemoteFilename, ".tar.zst") {
+		t.Errorf("Expected remote filename to end with .tar.zst, got %s", settings.BackupTmpRemoteFilename)
+	}
+	
+	// Backups taken before switching format are still recognized
+	if _, ok := settings.BackupTime("gitea-backup-2024-02-29-23-15-30.zip"); !ok {
+		t.Error("Expected zip backup to match the template")
+	}
+	
+	os.Setenv("BACKUP_ARCHIVE_FORMAT", "tar.gz")
+	if _, err := config.NewSettings(); err == nil {
+		t.Error("Expected error for compression level 19 with tar.gz, got nil")
+	}
+	
+	os.Setenv("BACKUP_ARCHIVE_FORMAT", "rar")
+	os.Setenv("BACKUP_COMPRESSION_LEVEL", "0")
+	if _, err := config.NewSettings(); err == nil {
+		t.Error("Expected error for unsupported archive format, got nil")
+	}
+}
+
+func TestNewSettings_Encryption(t *testing.T) {
+	clearEnvVars()
+	
+	os.Setenv("BACKUP_METHODE", "s3")
+	os.Setenv("BACKUP_ENCRYPTION_RECIPIENTS", "age1first, age1second")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(settings.EncryptionRecipients) != 2 || settings.EncryptionRecipients[1] != "age1second" {
+		t.Errorf("Unexpected recipients: %v", settings.EncryptionRecipients)
+	}
+	
+	os.Setenv("BACKUP_ENCRYPTION_PASSPHRASE", "secret")
+	if _, err := config.NewSettings(); err == nil {
+		t.Error("Expected error when both recipients and passphrase are set, got nil")
+	}
+}
+
+func TestNewSettings_Signing(t *testing.T) {
+	clearEnvVars()
+	
+	os.Setenv("BACKUP_METHODE", "s3")
+	os.Setenv("BACKUP_SIGNING_KEY_FILE", "/keys/backup.key")
+	os.Setenv("BACKUP_SIGNING_PUBLIC_KEY_FILE", "/keys/backup.pub")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.SigningKeyFile != "/keys/backup.key" {
+		t.Errorf("Expected SigningKeyFile '/keys/backup.key', got '%s'", settings.SigningKeyFile)
+	}
+	if settings.SigningPublicKeyFile != "/keys/backup.pub" {
+		t.Errorf("Expected SigningPublicKeyFile '/keys/backup.pub', got '%s'", settings.SigningPublicKeyFile)
+	}
+}
+
+func TestSettings_StringRedactsSecrets(t *testing.T) {
+	settings := &config.Settings{
+		BackupMethod:         "s3",
+		EncryptionPassphrase: "correct horse battery staple",
+	}
+	
+	for _, logged := range []string{fmt.Sprintf("%+v", settings), fmt.Sprintf("%v", *settings)} {
+		if strings.Contains(logged, "correct horse") {
+			t.Errorf("Expected the passphrase to be redacted: %s", logged)
+		}
+		if !strings.Contains(logged, "BackupMethod:s3") || !strings.Contains(logged, "EncryptionPassphrase:[REDACTED]") {
+			t.Errorf("Unexpected settings output: %s", logged)
+		}
+	}
+	
+	if settings.EncryptionPassphrase != "correct horse battery staple" {
+		t.Error("Expected formatting to leave the settings untouched")
+	}
+}
+
+func TestNewSettings_Logging(t *testing.T) {
+	clearEnvVars()
+	os.Setenv("BACKUP_METHOD", "local")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.LogLevel != "info" || settings.LogFormat != "text" {
+		t.Errorf("Expected info level text logs by default, got %s %s", settings.LogLevel, settings.LogFormat)
+	}
+	
+	os.Setenv("LOG_LEVEL", "debug")
+	os.Setenv("LOG_FORMAT", "json")
+	settings, err = config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.LogLevel != "debug" || settings.LogFormat != "json" {
+		t.Errorf("Expected debug level JSON logs, got %s %s", settings.LogLevel, settings.LogFormat)
+	}
+	
+	for name, value := range map[string]string{"LOG_LEVEL": "verbose", "LOG_FORMAT": "xml"} {
+		clearEnvVars()
+		os.Setenv("BACKUP_METHOD", "local")
+		os.Setenv(name, value)
+		if _, err := config.NewSettings(); err == nil {
+			t.Errorf("Expected error for %s=%s, got nil", name, value)
+		}
+	}
+}
+
+func TestNewSettings_PostgresDump(t *testing.T) {
+	clearEnvVars()
+	os.Setenv("BACKUP_METHOD", "local")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.PostgresDumpFormat != config.PostgresFormatPlain || settings.PostgresJobs != 1 {
+		t.Errorf("Expected plain dumps with 1 job by default, got %s with %d", settings.PostgresDumpFormat, settings.PostgresJobs)
+	}
+	
+	os.Setenv("POSTGRES_DUMP_FORMAT", "directory")
+	os.Setenv("POSTGRES_JOBS", "4")
+	settings, err = config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.PostgresDumpFormat != config.PostgresFormatDirectory || settings.PostgresJobs != 4 {
+		t.Errorf("Expected directory dumps with 4 jobs, got %s with %d", settings.PostgresDumpFormat, settings.PostgresJobs)
+	}
+	
+	for name, value := range map[string]string{"POSTGRES_DUMP_FORMAT": "tar", "POSTGRES_JOBS": "0"} {
+		clearEnvVars()
+		os.Setenv("BACKUP_METHOD", "local")
+		os.Setenv(name, value)
+		if _, err := config.NewSettings(); err == nil {
+			t.Errorf("Expected error for %s=%s, got nil", name, value)
+		}
+	}
+}
+
+func TestNewSettings_MySQLDumpRoutines(t *testing.T) {
+	clearEnvVars()
+	os.Setenv("BACKUP_METHOD", "local")
+	defer clearEnvVars()
+	
+	settings, err := config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.MySQLDumpRoutines {
+		t.Error("Expected MySQLDumpRoutines to be false by default")
+	}
+	
+	os.Setenv("MYSQL_DUMP_ROUTINES", "true")
+	settings, err = config.NewSettings()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !settings.MySQLDumpRoutines {
+		t.Error("Expected MySQLDumpRoutines to be true")
+	}
+	
+	os.Setenv("MYSQL_DUMP_ROUTINES", "always")
+	if _, err := config.NewSettings(); err == nil {
+		t.Error("Expected error for invalid MYSQL_DUMP_ROUTINES, got nil")
+	}
+}
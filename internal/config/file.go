@@ -0,0 +1,161 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv is the environment variable naming the YAML configuration file
+const ConfigFileEnv = "BACKUP_CONFIG_FILE"
+
+// storageKeys maps the keys of the storage sections of the configuration
+// file to the environment variables read by the storage backends
+var storageKeys = map[string]map[string]string{
+	"s3": {
+		"endpoint_url":           "ENDPOINT_URL",
+		"access_key_id":          "AWS_ACCESS_KEY_ID",
+		"access_key_id_file":     "AWS_ACCESS_KEY_ID_FILE",
+		"secret_access_key":      "AWS_SECRET_ACCESS_KEY",
+		"secret_access_key_file": "AWS_SECRET_ACCESS_KEY_FILE",
+		"bucket":                 "BUCKET",
+		"prefix":                 "PREFIX",
+		"region":                 "REGION",
+		"signature_version":      "SIGNATURE_VERSION",
+		"verify":                 "VERIFY",
+		"log_debug":              "S3_LOG_DEBUG",
+		"part_size_mb":           "S3_PART_SIZE_MB",
+		"upload_concurrency":     "S3_UPLOAD_CONCURRENCY",
+	},
+	"ftp": {
+		"host":          "BACKUP_FTP_HOST",
+		"user":          "BACKUP_FTP_USER",
+		"password":      "BACKUP_FTP_PASSWORD",
+		"password_file": "BACKUP_FTP_PASSWORD_FILE",
+		"dir":           "BACKUP_FTP_DIR",
+	},
+	"sftp": {
+		"host":                        "BACKUP_SFTP_HOST",
+		"user":                        "BACKUP_SFTP_USER",
+		"password":                    "BACKUP_SFTP_PASSWORD",
+		"password_file":               "BACKUP_SFTP_PASSWORD_FILE",
+		"private_key":                 "BACKUP_SFTP_PRIVATE_KEY",
+		"private_key_passphrase":      "BACKUP_SFTP_PRIVATE_KEY_PASSPHRASE",
+		"private_key_passphrase_file": "BACKUP_SFTP_PRIVATE_KEY_PASSPHRASE_FILE",
+		"known_hosts":                 "BACKUP_SFTP_KNOWN_HOSTS",
+		"dir":                         "BACKUP_SFTP_DIR",
+	},
+	"local": {
+		"dir": "BACKUP_LOCAL_DIR",
+	},
+}
+
+// Getenv returns the value of the environment variable name or, when it is
+// not set, the value the configuration file of the settings gives it.
+// Storage backends read their settings through Getenv.
+func (s *Settings) Getenv(name string) string {
+	if val := os.Getenv(name); val != "" {
+		return val
+	}
+	return s.fileValue(name)
+}
+
+// fileValue returns the value the configuration file gives the environment
+// variable name, or an empty string
+func (s *Settings) fileValue(name string) string {
+	return s.fileValues[name]
+}
+
+// LoadFile reads the YAML configuration file at path and returns its values
+// keyed by the environment variable each one stands for. Keys use the yaml
+// names of Settings, plus s3, ftp, sftp and local sections for the storage
+// backends. Unknown keys are an error.
+func LoadFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	var doc yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	settingKeys := make(map[string]string, len(settingFlags))
+	for _, setting := range settingFlags {
+		settingKeys[setting.Key] = setting.Env
+		if setting.Secret {
+			file := secretFileFlag(setting)
+			settingKeys[file.Key] = file.Env
+		}
+	}
+
+	values := make(map[string]string)
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("invalid configuration file %s: line %d: expected a mapping", path, root.Line)
+	}
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+
+		if sectionKeys, ok := storageKeys[key.Value]; ok {
+			if value.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("invalid configuration file %s: line %d: %s must be a mapping", path, value.Line, key.Value)
+			}
+			for j := 0; j < len(value.Content); j += 2 {
+				subKey, subValue := value.Content[j], value.Content[j+1]
+				env, ok := sectionKeys[subKey.Value]
+				if !ok {
+					return nil, fmt.Errorf("invalid configuration file %s: line %d: unknown key %s.%s", path, subKey.Line, key.Value, subKey.Value)
+				}
+				if err := setFileValue(values, env, subValue); err != nil {
+					return nil, fmt.Errorf("invalid configuration file %s: line %d: %s.%s %w", path, subValue.Line, key.Value, subKey.Value, err)
+				}
+			}
+			continue
+		}
+
+		env, ok := settingKeys[key.Value]
+		if !ok {
+			return nil, fmt.Errorf("invalid configuration file %s: line %d: unknown key %s", path, key.Line, key.Value)
+		}
+		if err := setFileValue(values, env, value); err != nil {
+			return nil, fmt.Errorf("invalid configuration file %s: line %d: %s %w", path, value.Line, key.Value, err)
+		}
+	}
+
+	return values, nil
+}
+
+// setFileValue records a scalar, or a list of scalars joined with commas,
+// under env. Null values leave the setting unset.
+func setFileValue(values map[string]string, env string, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return nil
+		}
+		values[env] = node.Value
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("must be a list of values")
+			}
+			items = append(items, item.Value)
+		}
+		values[env] = strings.Join(items, ",")
+	default:
+		return fmt.Errorf("must be a value or a list of values")
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write configuration file: %v", err)
+	}
+	return path
+}
+
+func TestNewSettings_ConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+backup_method: s3
+backup_prefix: from-file
+backup_max_retention: 7
+backup_max_age: 90d
+backup_streaming: true
+encryption_recipients:
+  - age1first
+  - age1second
+s3:
+  bucket: backups
+  part_size_mb: 16
+`)
+	t.Setenv(ConfigFileEnv, path)
+	t.Setenv("BACKUP_MAX_RETENTION", "3")
+	t.Setenv("BUCKET", "")
+	t.Setenv("REGION", "eu-west-1")
+
+	overrides := map[string]string{"BACKUP_PREFIX": "from-flag"}
+	settings, err := NewSettingsWithOverrides(overrides)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// defaults < file < environment < flags
+	if settings.BackupMethod != "s3" {
+		t.Errorf("Expected backup_method from the file, got '%s'", settings.BackupMethod)
+	}
+	if settings.BackupMaxRetention != 3 {
+		t.Errorf("Expected BACKUP_MAX_RETENTION to override the file, got %d", settings.BackupMaxRetention)
+	}
+	if settings.BackupPrefix != "from-flag" {
+		t.Errorf("Expected the flag to override the file, got '%s'", settings.BackupPrefix)
+	}
+	if settings.BackupMaxAge != 90*24*time.Hour || !settings.BackupStreaming {
+		t.Errorf("Unexpected settings from the file: %+v", settings)
+	}
+	if strings.Join(settings.EncryptionRecipients, " ") != "age1first age1second" {
+		t.Errorf("Unexpected recipients: %v", settings.EncryptionRecipients)
+	}
+	if settings.BackupArchiveFormat != ArchiveFormatZip {
+		t.Errorf("Expected the default archive format, got '%s'", settings.BackupArchiveFormat)
+	}
+
+	// Storage backends see the storage sections through Settings.Getenv
+	if got := settings.Getenv("BUCKET"); got != "backups" {
+		t.Errorf("Expected BUCKET from the file, got '%s'", got)
+	}
+	if got := settings.Getenv("REGION"); got != "eu-west-1" {
+		t.Errorf("Expected REGION from the environment, got '%s'", got)
+	}
+	if got := settings.Getenv("S3_PART_SIZE_MB"); got != "16" {
+		t.Errorf("Expected S3_PART_SIZE_MB from the file, got '%s'", got)
+	}
+}
+
+func TestNewSettings_ConfigFileFlag(t *testing.T) {
+	path := writeConfigFile(t, "backup_method: local\nlocal:\n  dir: /srv/backups\n")
+	t.Setenv(ConfigFileEnv, "")
+
+	settings, err := NewSettingsWithOverrides(map[string]string{ConfigFileEnv: path})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if settings.BackupMethod != "local" || settings.Getenv("BACKUP_LOCAL_DIR") != "/srv/backups" {
+		t.Errorf("Expected the configuration file given as a flag to be loaded")
+	}
+}
+
+func TestNewSettings_ConfigFileLegacyMethodEnv(t *testing.T) {
+	path := writeConfigFile(t, "backup_method: s3\nlocal:\n  dir: /srv/backups\n")
+	t.Setenv(ConfigFileEnv, path)
+	t.Setenv("BACKUP_METHOD", "")
+	t.Setenv("BACKUP_METHODE", "local")
+
+	settings, err := NewSettingsWithOverrides(nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if settings.BackupMethod != "local" {
+		t.Errorf("Expected BACKUP_METHODE to override the file, got '%s'", settings.BackupMethod)
+	}
+}
+
+func TestNewSettings_ConfigFileSecretsNotLogged(t *testing.T) {
+	path := writeConfigFile(t, `
+backup_method: s3
+encryption_passphrase: PASSPHRASE
+s3:
+  secret_access_key: SUPERSECRET
+ftp:
+  password: FTPSECRET
+`)
+	t.Setenv(ConfigFileEnv, path)
+	t.Setenv("BACKUP_METHOD", "")
+	t.Setenv("BACKUP_ENCRYPTION_PASSPHRASE", "")
+	t.Setenv("BACKUP_ENCRYPTION_RECIPIENTS", "")
+
+	settings, err := NewSettingsWithOverrides(nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// As logged by the CLI at debug level
+	logged := fmt.Sprintf("%+v", settings)
+	for _, secret := range []string{"PASSPHRASE", "SUPERSECRET", "FTPSECRET"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("Expected %s not to be logged: %s", secret, logged)
+		}
+	}
+	if settings.Getenv("AWS_SECRET_ACCESS_KEY") != "SUPERSECRET" {
+		t.Error("Expected formatting to leave the configuration file values untouched")
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown key", "backup_method: s3\nbackup_prefx: typo\n", "line 2: unknown key backup_prefx"},
+		{"unknown storage key", "s3:\n  bucket: b\n  bukket: typo\n", "line 3: unknown key s3.bukket"},
+		{"section not a mapping", "ftp: ftp.example.com\n", "ftp must be a mapping"},
+		{"nested value", "backup_prefix:\n  a: b\n", "backup_prefix must be a value"},
+		{"not a mapping", "- backup_method\n", "expected a mapping"},
+		{"invalid yaml", "backup_method: [s3\n", "invalid configuration file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writeConfigFile(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadFile_Empty(t *testing.T) {
+	values, err := LoadFile(writeConfigFile(t, "# nothing yet\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(values) != 0 {
+		t.Errorf("Expected no values, got %v", values)
+	}
+}
+
+func TestSettingFlags_KeysMatchSettings(t *testing.T) {
+	keys := make(map[string]bool)
+	for _, key := range yamlKeys() {
+		keys[key] = true
+	}
+	for _, setting := range settingFlags {
+		if !keys[setting.Key] {
+			t.Errorf("Flag %s uses key %s, which is not a yaml key of Settings", setting.Name, setting.Key)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+// settingFlag binds a command line flag and a configuration file key to the
+// environment variable they stand for
+type settingFlag struct {
+	Name   string
+	Key    string
+	Env    string
+	IsBool bool
+	// Secret settings can also be read from a file, see GetSecret
+	Secret bool
+	Usage  string
+}
+
+// configFileFlag selects the configuration file. It is not a setting itself.
+var configFileFlag = settingFlag{Name: "config", Env: ConfigFileEnv, Usage: "YAML configuration file"}
+
+// settingFlags lists a flag for every setting read from the environment
+var settingFlags = []settingFlag{
+	{Name: "enable", Key: "backup_enable", Env: "BACKUP_ENABLE", IsBool: true, Usage: "enable the backup process"},
+	{Name: "method", Key: "backup_method", Env: "BACKUP_METHOD", Usage: "storage backend: s3, ftp, sftp or local"},
+	{Name: "file", Key: "backup_filename", Env: "BACKUP_FILENAME", Usage: "backup to restore, verify or inspect: a file name, \"latest\" or a date such as 2024-03-15"},
+	{Name: "file-log", Key: "backup_file_log", Env: "BACKUP_FILE_LOG", Usage: "history log of backed up and restored files"},
+	{Name: "remote-filename", Key: "backup_tmp_remote_filename", Env: "BACKUP_TMP_REMOTE_FILENAME", Usage: "remote file name template, with @prefix, @date and @ext placeholders"},
+	{Name: "prefix", Key: "backup_prefix", Env: "BACKUP_PREFIX", Usage: "prefix of the backup file names"},
+	{Name: "max-retention", Key: "backup_max_retention", Env: "BACKUP_MAX_RETENTION", Usage: "number of most recent backups to keep, 0 disables this rule"},
+	{Name: "keep-daily", Key: "backup_keep_daily", Env: "BACKUP_KEEP_DAILY", Usage: "keep the newest backup of each of the last N days"},
+	{Name: "keep-weekly", Key: "backup_keep_weekly", Env: "BACKUP_KEEP_WEEKLY", Usage: "keep the newest backup of each of the last N ISO weeks"},
+	{Name: "keep-monthly", Key: "backup_keep_monthly", Env: "BACKUP_KEEP_MONTHLY", Usage: "keep the newest backup of each of the last N months"},
+	{Name: "keep-yearly", Key: "backup_keep_yearly", Env: "BACKUP_KEEP_YEARLY", Usage: "keep the newest backup of each of the last N years"},
+	{Name: "max-age", Key: "backup_max_age", Env: "BACKUP_MAX_AGE", Usage: "delete backups older than this, such as 90d, 12w or 36h"},
+	{Name: "max-total-size", Key: "backup_max_total_size", Env: "BACKUP_MAX_TOTAL_SIZE", Usage: "keep the newest backups that fit in this size, such as 500GB or 2TiB"},
+	{Name: "dry-run", Key: "backup_retention_dry_run", Env: "BACKUP_RETENTION_DRY_RUN", IsBool: true, Usage: "list retention decisions without deleting anything"},
+	{Name: "format", Key: "backup_archive_format", Env: "BACKUP_ARCHIVE_FORMAT", Usage: "archive format: zip, tar.gz or tar.zst"},
+	{Name: "compression-level", Key: "backup_compression_level", Env: "BACKUP_COMPRESSION_LEVEL", Usage: "compression level, 1-9 for zip and tar.gz, 1-22 for tar.zst, 0 for the default"},
+	{Name: "streaming", Key: "backup_streaming", Env: "BACKUP_STREAMING", IsBool: true, Usage: "stream the archive to remote storage without the tmp folder and file, zip archives only"},
+	{Name: "postgres-format", Key: "postgres_dump_format", Env: "POSTGRES_DUMP_FORMAT", Usage: "PostgreSQL dump format: plain, custom or directory"},
+	{Name: "postgres-jobs", Key: "postgres_jobs", Env: "POSTGRES_JOBS", Usage: "parallel jobs of pg_restore, and of pg_dump in directory format"},
+	{Name: "mysql-routines", Key: "mysql_dump_routines", Env: "MYSQL_DUMP_ROUTINES", IsBool: true, Usage: "also dump the stored routines and events of MySQL databases"},
+	{Name: "mssql-trust-server-certificate", Key: "mssql_trust_server_certificate", Env: "MSSQL_TRUST_SERVER_CERTIFICATE", IsBool: true, Usage: "do not validate the certificate of the SQL Server"},
+	{Name: "encryption-recipients", Key: "encryption_recipients", Env: "BACKUP_ENCRYPTION_RECIPIENTS", Usage: "encrypt archives for these comma separated age public keys"},
+	{Name: "encryption-identity-file", Key: "encryption_identity_file", Env: "BACKUP_ENCRYPTION_IDENTITY_FILE", Usage: "age identity file used to decrypt archives"},
+	{Name: "encryption-passphrase", Key: "encryption_passphrase", Env: "BACKUP_ENCRYPTION_PASSPHRASE", Secret: true, Usage: "encrypt and decrypt archives with a passphrase, prefer --encryption-passphrase-file"},
+	{Name: "signing-key-file", Key: "signing_key_file", Env: "BACKUP_SIGNING_KEY_FILE", Usage: "Ed25519 private key (PEM) used to sign archives"},
+	{Name: "signing-public-key-file", Key: "signing_public_key_file", Env: "BACKUP_SIGNING_PUBLIC_KEY_FILE", Usage: "Ed25519 public key (PEM) that restored archives must be signed with"},
+	{Name: "tmp-folder", Key: "backup_tmp_folder", Env: "BACKUP_TMP_FOLDER", Usage: "temporary backup folder"},
+	{Name: "tmp-filename", Key: "backup_tmp_filename", Env: "BACKUP_TMP_FILENAME", Usage: "temporary backup archive"},
+	{Name: "restore-tmp-folder", Key: "restore_tmp_folder", Env: "RESTORE_TMP_FOLDER", Usage: "temporary restore folder"},
+	{Name: "restore-tmp-filename", Key: "restore_tmp_filename", Env: "RESTORE_TMP_FILENAME", Usage: "temporary restore archive"},
+	{Name: "log-level", Key: "log_level", Env: "LOG_LEVEL", Usage: "log level: debug, info, warn or error"},
+	{Name: "log-format", Key: "log_format", Env: "LOG_FORMAT", Usage: "log format: text, or json for one object per line"},
+	{Name: "app-ini", Key: "app_ini_path", Env: "APP_INI_PATH", Usage: "path of the Gitea app.ini"},
+	{Name: "gitea-user", Key: "gitea_user", Env: "GITEA_USER", Usage: "user owning the Gitea files"},
+}
+
+// envFlag records the value of a setting flag under its environment variable
+type envFlag struct {
+	setting   settingFlag
+	overrides map[string]string
+}
+
+func (f *envFlag) String() string {
+	if f.overrides == nil {
+		return ""
+	}
+	return f.overrides[f.setting.Env]
+}
+
+func (f *envFlag) Set(value string) error {
+	if f.setting.IsBool {
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+	}
+	f.overrides[f.setting.Env] = value
+	return nil
+}
+
+func (f *envFlag) IsBoolFlag() bool {
+	return f.setting.IsBool
+}
+
+// RegisterFlags defines a flag on fs for every setting. Once fs is parsed,
+// the returned map holds the value of every flag given on the command line,
+// keyed by the environment variable it overrides, ready for
+// NewSettingsWithOverrides.
+func RegisterFlags(fs *flag.FlagSet) map[string]string {
+	overrides := make(map[string]string)
+	for _, setting := range append([]settingFlag{configFileFlag}, settingFlags...) {
+		usage := fmt.Sprintf("%s (env %s)", setting.Usage, setting.Env)
+		fs.Var(&envFlag{setting: setting, overrides: overrides}, setting.Name, usage)
+		if setting.Secret {
+			file := secretFileFlag(setting)
+			usage := fmt.Sprintf("%s (env %s)", file.Usage, file.Env)
+			fs.Var(&envFlag{setting: file, overrides: overrides}, file.Name, usage)
+		}
+	}
+	return overrides
+}
+
+// secretFileFlag returns the flag reading a secret setting from a file
+func secretFileFlag(setting settingFlag) settingFlag {
+	return settingFlag{
+		Name:  setting.Name + "-file",
+		Key:   setting.Key + "_file",
+		Env:   setting.Env + SecretFileSuffix,
+		Usage: "file holding the value of --" + setting.Name,
+	}
+}
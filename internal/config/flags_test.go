@@ -0,0 +1,76 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFlags_OverrideEnvironment(t *testing.T) {
+	t.Setenv("BACKUP_METHOD", "s3")
+	t.Setenv("BACKUP_PREFIX", "from-env")
+	t.Setenv("BACKUP_MAX_RETENTION", "3")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	overrides := RegisterFlags(fs)
+	if err := fs.Parse([]string{"--method", "local", "--max-retention=10", "--streaming"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	settings, err := NewSettingsWithOverrides(overrides)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.BackupMethod != "local" {
+		t.Errorf("Expected flag to override BACKUP_METHOD, got '%s'", settings.BackupMethod)
+	}
+	if settings.BackupMaxRetention != 10 {
+		t.Errorf("Expected flag to override BACKUP_MAX_RETENTION, got %d", settings.BackupMaxRetention)
+	}
+	if !settings.BackupStreaming {
+		t.Error("Expected --streaming without a value to enable streaming")
+	}
+	if settings.BackupPrefix != "from-env" {
+		t.Errorf("Expected BACKUP_PREFIX from the environment, got '%s'", settings.BackupPrefix)
+	}
+}
+
+func TestRegisterFlags_InvalidBool(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"--streaming=maybe"}); err == nil {
+		t.Error("Expected error for an invalid boolean flag, got nil")
+	}
+}
+
+func TestSettingFlags_CoverEverySetting(t *testing.T) {
+	// Every setting with a yaml key must be reachable from the command line
+	fields := len(yamlKeys())
+	if fields != len(settingFlags) {
+		t.Errorf("Settings has %d fields but %d flags are defined", fields, len(settingFlags))
+	}
+
+	names := make(map[string]bool)
+	for _, setting := range settingFlags {
+		if names[setting.Name] {
+			t.Errorf("Flag %s is defined twice", setting.Name)
+		}
+		names[setting.Name] = true
+	}
+}
+
+// yamlKeys returns the yaml key of every field of Settings
+func yamlKeys() []string {
+	var keys []string
+	settingsType := reflect.TypeOf(Settings{})
+	for i := 0; i < settingsType.NumField(); i++ {
+		if tag, ok := settingsType.Field(i).Tag.Lookup("yaml"); ok {
+			key, _, _ := strings.Cut(tag, ",")
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
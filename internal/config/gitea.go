@@ -60,6 +60,8 @@ func ReadGiteaConfig(iniPath string) (*GiteaConfig, error) {
 				config.Database.User = value
 			case "PASSWD":
 				config.Database.Passwd = value
+			case "CHARSET":
+				config.Database.Charset = value
 			case "PATH":
 				config.Database.Path = value
 			}
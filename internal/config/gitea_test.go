@@ -1,8 +1,10 @@
 package config_test
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Frantche/gitea-backup-restore-process/internal/config"
@@ -19,6 +21,7 @@ HOST = localhost:3306
 NAME = gitea
 USER = root
 PASSWD = password
+CHARSET = utf8mb4
 
 [repository]
 ROOT = /data/git/repositories
@@ -60,6 +63,10 @@ REPOSITORY_AVATAR_UPLOAD_PATH = /data/gitea/repo-avatars
 		t.Errorf("Expected PASSWD to be 'password', got %v", giteaConfig.Database.Passwd)
 	}
 	
+	if giteaConfig.Database.Charset != "utf8mb4" {
+		t.Errorf("Expected CHARSET to be 'utf8mb4', got %v", giteaConfig.Database.Charset)
+	}
+	
 	// Verify repository config
 	if giteaConfig.Repository.Root != "/data/git/repositories" {
 		t.Errorf("Expected ROOT to be '/data/git/repositories', got %v", giteaConfig.Repository.Root)
@@ -155,4 +162,17 @@ func TestReadGiteaConfig_NonExistentFile(t *testing.T) {
 	if err == nil {
 		t.Fatal("Expected error for non-existent file, got nil")
 	}
-}
\ No newline at end of file
+}
+func TestGiteaConfig_StringRedactsPassword(t *testing.T) {
+	giteaConfig := &config.GiteaConfig{
+		Database: config.DatabaseConfig{DBType: "mysql", User: "gitea", Passwd: "s3cret"},
+	}
+	
+	logged := fmt.Sprintf("%+v", giteaConfig)
+	if strings.Contains(logged, "s3cret") {
+		t.Errorf("Expected the database password to be redacted: %s", logged)
+	}
+	if !strings.Contains(logged, "User:gitea") {
+		t.Errorf("Unexpected Gitea config output: %s", logged)
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretFileSuffix is appended to the name of a credential variable to read
+// the credential from a file instead, as with Docker and Kubernetes secrets
+const SecretFileSuffix = "_FILE"
+
+// GetSecret returns the credential held by the environment variable name or
+// read from the file named by name + "_FILE". The environment takes
+// precedence over the configuration file of the settings, whichever form
+// each of them uses: FOO in the environment wins over FOO_FILE in the file,
+// and FOO_FILE in the environment over FOO in the file. Setting both forms
+// in the same place is an error.
+func (s *Settings) GetSecret(name string) (string, error) {
+	return readSecret(name, os.Getenv, s.fileValue)
+}
+
+// readSecret reads the credential name from the first of sources that sets
+// either name or name + "_FILE". The later sources are not looked at, so the
+// two forms only conflict when they come from the same source.
+func readSecret(name string, sources ...func(name string) string) (string, error) {
+	for _, getenv := range sources {
+		val := getenv(name)
+		path := getenv(name + SecretFileSuffix)
+		if val == "" && path == "" {
+			continue
+		}
+		if path == "" {
+			return val, nil
+		}
+		if val != "" {
+			return "", fmt.Errorf("%s and %s%s cannot both be set", name, name, SecretFileSuffix)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s%s: %w", name, SecretFileSuffix, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("s3cret \r\n\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	settings := &Settings{}
+	t.Setenv("TEST_PASSWORD", "inline")
+	t.Setenv("TEST_PASSWORD_FILE", "")
+	if got, err := settings.GetSecret("TEST_PASSWORD"); err != nil || got != "inline" {
+		t.Errorf("Expected the variable value, got %q, %v", got, err)
+	}
+
+	t.Setenv("TEST_PASSWORD", "")
+	t.Setenv("TEST_PASSWORD_FILE", path)
+	// Only trailing newlines are trimmed
+	if got, err := settings.GetSecret("TEST_PASSWORD"); err != nil || got != "s3cret " {
+		t.Errorf("Expected the file content, got %q, %v", got, err)
+	}
+
+	t.Setenv("TEST_PASSWORD", "inline")
+	if _, err := settings.GetSecret("TEST_PASSWORD"); err == nil || !strings.Contains(err.Error(), "cannot both be set") {
+		t.Errorf("Expected error when both forms are set, got %v", err)
+	}
+
+	t.Setenv("TEST_PASSWORD", "")
+	t.Setenv("TEST_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := settings.GetSecret("TEST_PASSWORD"); err == nil {
+		t.Error("Expected error for a missing secret file, got nil")
+	}
+}
+
+func TestNewSettings_PassphraseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(path, []byte("correct horse battery staple\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv("BACKUP_METHOD", "local")
+	t.Setenv("BACKUP_ENCRYPTION_PASSPHRASE", "")
+	t.Setenv("BACKUP_ENCRYPTION_RECIPIENTS", "")
+
+	settings, err := NewSettingsWithOverrides(map[string]string{"BACKUP_ENCRYPTION_PASSPHRASE_FILE": path})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.EncryptionPassphrase != "correct horse battery staple" {
+		t.Errorf("Expected the passphrase from the file, got %q", settings.EncryptionPassphrase)
+	}
+}
+
+func TestGetSecret_EnvironmentOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("from-env-file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	settings := &Settings{fileValues: map[string]string{"AWS_SECRET_ACCESS_KEY": "from-config"}}
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY_FILE", path)
+	if got, err := settings.GetSecret("AWS_SECRET_ACCESS_KEY"); err != nil || got != "from-env-file" {
+		t.Errorf("Expected the environment to override the file, got %q, %v", got, err)
+	}
+
+	t.Setenv("AWS_SECRET_ACCESS_KEY_FILE", "")
+	if got, err := settings.GetSecret("AWS_SECRET_ACCESS_KEY"); err != nil || got != "from-config" {
+		t.Errorf("Expected the value from the file, got %q, %v", got, err)
+	}
+
+	// A value in the environment wins over a _FILE in the file
+	delete(settings.fileValues, "AWS_SECRET_ACCESS_KEY")
+	settings.fileValues["AWS_SECRET_ACCESS_KEY_FILE"] = path
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "from-env")
+	if got, err := settings.GetSecret("AWS_SECRET_ACCESS_KEY"); err != nil || got != "from-env" {
+		t.Errorf("Expected the environment value to override the file, got %q, %v", got, err)
+	}
+
+	// Both forms in the configuration file are still an error
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	settings.fileValues["AWS_SECRET_ACCESS_KEY"] = "from-config"
+	if _, err := settings.GetSecret("AWS_SECRET_ACCESS_KEY"); err == nil || !strings.Contains(err.Error(), "cannot both be set") {
+		t.Errorf("Expected error when both forms are in the file, got %v", err)
+	}
+}
+
+func TestNewSettings_PassphraseLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(path, []byte("from-flag-file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv(ConfigFileEnv, writeConfigFile(t, "backup_method: local\nencryption_passphrase: from-config\n"))
+	t.Setenv("BACKUP_METHOD", "")
+	t.Setenv("BACKUP_ENCRYPTION_PASSPHRASE", "from-env")
+	t.Setenv("BACKUP_ENCRYPTION_PASSPHRASE_FILE", "")
+	t.Setenv("BACKUP_ENCRYPTION_RECIPIENTS", "")
+
+	settings, err := NewSettingsWithOverrides(nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.EncryptionPassphrase != "from-env" {
+		t.Errorf("Expected the passphrase from the environment, got %q", settings.EncryptionPassphrase)
+	}
+
+	settings, err = NewSettingsWithOverrides(map[string]string{"BACKUP_ENCRYPTION_PASSPHRASE_FILE": path})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if settings.EncryptionPassphrase != "from-flag-file" {
+		t.Errorf("Expected the passphrase file flag to win, got %q", settings.EncryptionPassphrase)
+	}
+}
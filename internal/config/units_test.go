@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"90d", 90 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"36h", 36 * time.Hour},
+		{"1h30m", 90 * time.Minute},
+	}
+
+	for _, test := range tests {
+		d, err := ParseDuration(test.input)
+		if err != nil {
+			t.Errorf("ParseDuration(%q) returned error: %v", test.input, err)
+			continue
+		}
+		if d != test.expected {
+			t.Errorf("ParseDuration(%q) = %v, expected %v", test.input, d, test.expected)
+		}
+	}
+
+	for _, input := range []string{"", "soon", "1.5d", "-3d", "-1h", "1000000000d"} {
+		if _, err := ParseDuration(input); err == nil {
+			t.Errorf("Expected error for ParseDuration(%q), got nil", input)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	if got := FormatDuration(90 * 24 * time.Hour); got != "90d" {
+		t.Errorf("Expected 90d, got %s", got)
+	}
+	if got := FormatDuration(36 * time.Hour); got != "36h0m0s" {
+		t.Errorf("Expected 36h0m0s, got %s", got)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1048576", 1048576},
+		{"512B", 512},
+		{"500MB", 500 * 1000 * 1000},
+		{"50GiB", 50 << 30},
+		{"2 TiB", 2 << 40},
+	}
+
+	for _, test := range tests {
+		size, err := ParseSize(test.input)
+		if err != nil {
+			t.Errorf("ParseSize(%q) returned error: %v", test.input, err)
+			continue
+		}
+		if size != test.expected {
+			t.Errorf("ParseSize(%q) = %d, expected %d", test.input, size, test.expected)
+		}
+	}
+
+	for _, input := range []string{"", "big", "1.5GB", "-1MB", "10XB", "9000000TiB", "9223372036854775807KB"} {
+		if _, err := ParseSize(input); err == nil {
+			t.Errorf("Expected error for ParseSize(%q), got nil", input)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:                "0 B",
+		1023:             "1023 B",
+		1536:             "1.5 KiB",
+		50 << 20:         "50.0 MiB",
+		3 << 40:          "3.0 TiB",
+		5000 * (1 << 40): "5000.0 TiB",
+	}
+	for n, want := range tests {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// stderrLimit is how much of the end of the error output of a database
+// client tool is kept for its error
+const stderrLimit = 4096
+
+// runClient runs a database client tool and, if it fails, returns an error
+// with the end of its error output, which holds the reason it failed
+func runClient(cmd *exec.Cmd) error {
+	stderr := &tailBuffer{limit: stderrLimit}
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(string(stderr.buf)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.limit {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.limit:]...)
+	}
+	return len(p), nil
+}
@@ -2,6 +2,10 @@ package database
 
 import (
 	"fmt"
+	"io"
+	"os"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
 	"github.com/Frantche/gitea-backup-restore-process/internal/config"
 	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
 )
@@ -10,6 +14,40 @@ import (
 type DatabaseAdapter interface {
 	Backup(settings *config.Settings, giteaConfig *config.GiteaConfig) error
 	Restore(settings *config.Settings, giteaConfig *config.GiteaConfig) error
+	// DumpName returns the name of the dump in the backup archive
+	DumpName() string
+}
+
+// StreamingAdapter is implemented by adapters that can write their dump to a
+// stream instead of a file in BackupTmpFolder
+type StreamingAdapter interface {
+	DatabaseAdapter
+	// Dump writes the database dump to w
+	Dump(w io.Writer, giteaConfig *config.GiteaConfig) error
+}
+
+// streamChecker is implemented by streaming adapters that cannot stream
+// every dump, depending on how they are configured
+type streamChecker interface {
+	// CanStream reports whether Dump can be used
+	CanStream() bool
+}
+
+// multiFormatAdapter is implemented by adapters whose dump name depends on
+// the dump format
+type multiFormatAdapter interface {
+	// DumpNames returns the name of the dump in every format
+	DumpNames() []string
+}
+
+// SupportedTypes lists the Gitea database types that can be backed up
+var SupportedTypes = []string{"mysql", "postgres", "sqlite3", "mssql"}
+
+// DumpChecker is implemented by adapters that can tell whether a dump is
+// complete and usable without restoring it
+type DumpChecker interface {
+	// CheckDump reads a whole dump from r and returns why it cannot be restored
+	CheckDump(r io.Reader) error
 }
 
 // GetAdapter returns the appropriate database adapter based on the database type
@@ -21,16 +59,77 @@ func GetAdapter(dbType string) (DatabaseAdapter, error) {
 		return &PostgreSQLAdapter{}, nil
 	case "sqlite3":
 		return &SQLiteAdapter{}, nil
+	case "mssql":
+		return &MSSQLAdapter{}, nil
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
 }
 
+// NewAdapter returns the adapter for dbType configured with settings, such
+// as the PostgreSQL dump format or the MySQL dump options
+func NewAdapter(settings *config.Settings, dbType string) (DatabaseAdapter, error) {
+	adapter, err := GetAdapter(dbType)
+	if err != nil {
+		return nil, err
+	}
+	
+	switch adapter := adapter.(type) {
+	case *PostgreSQLAdapter:
+		adapter.Format = settings.PostgresDumpFormat
+		adapter.Jobs = settings.PostgresJobs
+	case *MySQLAdapter:
+		adapter.Routines = settings.MySQLDumpRoutines
+	case *MSSQLAdapter:
+		adapter.TrustServerCertificate = settings.MSSQLTrustServerCert
+	}
+	return adapter, nil
+}
+
+// DumpName returns the name of the dump in the backup archive for dbType
+func DumpName(dbType string) (string, error) {
+	adapter, err := GetAdapter(dbType)
+	if err != nil {
+		return "", err
+	}
+	return adapter.DumpName(), nil
+}
+
+// DumpNames returns every name the dump of dbType can have in a backup
+// archive, the name of DumpName first
+func DumpNames(dbType string) ([]string, error) {
+	adapter, err := GetAdapter(dbType)
+	if err != nil {
+		return nil, err
+	}
+	if multiFormat, ok := adapter.(multiFormatAdapter); ok {
+		return multiFormat.DumpNames(), nil
+	}
+	return []string{adapter.DumpName()}, nil
+}
+
+// CheckDump reads a dbType dump from r and returns why it cannot be restored.
+// Dumps of adapters that cannot check them are only read.
+func CheckDump(dbType string, r io.Reader) error {
+	adapter, err := GetAdapter(dbType)
+	if err != nil {
+		return err
+	}
+	
+	checker, ok := adapter.(DumpChecker)
+	if !ok {
+		logger.Debugf("No dump check available for %s", dbType)
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}
+	return checker.CheckDump(r)
+}
+
 // BackupDatabase performs database backup using the appropriate adapter
 func BackupDatabase(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
 	logger.Infof("Starting database backup for %s", giteaConfig.Database.DBType)
 	
-	adapter, err := GetAdapter(giteaConfig.Database.DBType)
+	adapter, err := NewAdapter(settings, giteaConfig.Database.DBType)
 	if err != nil {
 		return err
 	}
@@ -39,7 +138,72 @@ func BackupDatabase(settings *config.Settings, giteaConfig *config.GiteaConfig)
 		return fmt.Errorf("database backup failed: %w", err)
 	}
 	
-	logger.Info("Database backup completed successfully")
+	logger.With("db_type", giteaConfig.Database.DBType).Info("Database backup completed successfully")
+	return nil
+}
+
+// StreamDatabase writes the database dump straight into archive. Adapters that
+// do not implement StreamingAdapter, or cannot stream with their settings,
+// dump to a scratch folder first.
+func StreamDatabase(archive *compression.Archive, settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	logger.Infof("Starting streaming database backup for %s", giteaConfig.Database.DBType)
+	
+	adapter, err := NewAdapter(settings, giteaConfig.Database.DBType)
+	if err != nil {
+		return err
+	}
+	
+	streamer, ok := adapter.(StreamingAdapter)
+	if checker, isChecker := adapter.(streamChecker); isChecker && !checker.CanStream() {
+		ok = false
+	}
+	if !ok {
+		return backupThroughScratchFolder(archive, adapter, settings, giteaConfig)
+	}
+	
+	pr, pw := io.Pipe()
+	dumpErr := make(chan error, 1)
+	go func() {
+		err := streamer.Dump(pw, giteaConfig)
+		pw.CloseWithError(err)
+		dumpErr <- err
+	}()
+	
+	if err := archive.AddStream(streamer.DumpName(), pr); err != nil {
+		// Unblock the dump if the archive stopped reading
+		pr.CloseWithError(err)
+		<-dumpErr
+		return fmt.Errorf("database backup failed: %w", err)
+	}
+	if err := <-dumpErr; err != nil {
+		return fmt.Errorf("database backup failed: %w", err)
+	}
+	
+	logger.With("db_type", giteaConfig.Database.DBType).Info("Database backup completed successfully")
+	return nil
+}
+
+// backupThroughScratchFolder runs a regular adapter backup in a temporary
+// folder and adds the result to archive
+func backupThroughScratchFolder(archive *compression.Archive, adapter DatabaseAdapter, settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	scratchDir, err := os.MkdirTemp("", "gitea-db-dump-*")
+	if err != nil {
+		return fmt.Errorf("failed to create scratch folder: %w", err)
+	}
+	defer os.RemoveAll(scratchDir)
+	
+	scratchSettings := *settings
+	scratchSettings.BackupTmpFolder = scratchDir
+	
+	if err := adapter.Backup(&scratchSettings, giteaConfig); err != nil {
+		return fmt.Errorf("database backup failed: %w", err)
+	}
+	
+	if err := archive.AddDir(scratchDir, ""); err != nil {
+		return fmt.Errorf("failed to add database dump to archive: %w", err)
+	}
+	
+	logger.With("db_type", giteaConfig.Database.DBType).Info("Database backup completed successfully")
 	return nil
 }
 
@@ -47,7 +211,7 @@ func BackupDatabase(settings *config.Settings, giteaConfig *config.GiteaConfig)
 func RestoreDatabase(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
 	logger.Infof("Starting database restore for %s", giteaConfig.Database.DBType)
 	
-	adapter, err := GetAdapter(giteaConfig.Database.DBType)
+	adapter, err := NewAdapter(settings, giteaConfig.Database.DBType)
 	if err != nil {
 		return err
 	}
@@ -56,6 +220,6 @@ func RestoreDatabase(settings *config.Settings, giteaConfig *config.GiteaConfig)
 		return fmt.Errorf("database restore failed: %w", err)
 	}
 	
-	logger.Info("Database restore completed successfully")
+	logger.With("db_type", giteaConfig.Database.DBType).Info("Database restore completed successfully")
 	return nil
 }
\ No newline at end of file
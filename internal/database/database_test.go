@@ -1,6 +1,7 @@
 package database_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Frantche/gitea-backup-restore-process/internal/config"
@@ -15,6 +16,7 @@ func TestGetAdapter(t *testing.T) {
 		{"mysql", false},
 		{"postgres", false},
 		{"sqlite3", false},
+		{"mssql", false},
 		{"unsupported", true},
 		{"", true},
 	}
@@ -99,4 +101,68 @@ func TestPostgreSQLAdapter_Creation(t *testing.T) {
 	if adapter == nil {
 		t.Fatal("PostgreSQL adapter should not be nil")
 	}
-}
\ No newline at end of file
+}
+
+func TestNewAdapter_PostgresFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		dumpName string
+	}{
+		{config.PostgresFormatPlain, "dump.postgres.sql"},
+		{config.PostgresFormatCustom, "dump.postgres.dump"},
+		{config.PostgresFormatDirectory, "dump.postgres/toc.dat"},
+	}
+	
+	for _, tt := range tests {
+		settings := &config.Settings{PostgresDumpFormat: tt.format, PostgresJobs: 4}
+		adapter, err := database.NewAdapter(settings, "postgres")
+		if err != nil {
+			t.Fatalf("Failed to get PostgreSQL adapter: %v", err)
+		}
+		if adapter.DumpName() != tt.dumpName {
+			t.Errorf("Expected %s dump name %s, got %s", tt.format, tt.dumpName, adapter.DumpName())
+		}
+	}
+	
+	// Backups of any format are recognized, the plain one being the default
+	names, err := database.DumpNames("postgres")
+	if err != nil {
+		t.Fatalf("DumpNames failed: %v", err)
+	}
+	if len(names) != 3 || names[0] != "dump.postgres.sql" {
+		t.Errorf("Unexpected PostgreSQL dump names: %v", names)
+	}
+	if names, _ := database.DumpNames("mysql"); len(names) != 1 || names[0] != "dump.mysql.sql" {
+		t.Errorf("Unexpected MySQL dump names: %v", names)
+	}
+}
+func TestCheckDump(t *testing.T) {
+	// A 512 bytes page SQLite database
+	sqlitePage := "SQLite format 3\x00\x02\x00" + strings.Repeat("\x00", 512-18)
+	
+	tests := []struct {
+		dbType  string
+		dump    string
+		wantErr bool
+	}{
+		{"mysql", "-- MySQL dump 10.13\nCREATE TABLE t;\n-- Dump completed on 2024-01-01\n", false},
+		{"mysql", "-- MariaDB dump 10.19\nCREATE TABLE t;\n-- Dump completed on 2024-01-01\n", false},
+		{"mysql", "-- MySQL dump 10.13\nCREATE TABLE t;\nINSERT INTO", true},
+		{"mysql", "", true},
+		{"postgres", "--\n-- PostgreSQL database dump\n--\nCREATE TABLE t;\n--\n-- PostgreSQL database dump complete\n--\n", false},
+		{"postgres", "--\n-- PostgreSQL database dump\n--\nCOPY t FROM stdin;\n", true},
+		{"postgres", "not a dump", true},
+		{"postgres", "PGDMP\x01\x0f\x00\x04\x08\x01\x01", false},
+		{"postgres", "PGDM", true},
+		{"sqlite3", sqlitePage + sqlitePage, false},
+		{"sqlite3", sqlitePage[:300], true},
+		{"sqlite3", "test database content", true},
+	}
+	
+	for _, tt := range tests {
+		err := database.CheckDump(tt.dbType, strings.NewReader(tt.dump))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckDump(%s, %.30q) error = %v, wantErr %v", tt.dbType, tt.dump, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// dumpCheckWindow is how much of the start and end of a text dump is kept to
+// look for its banner and trailer
+const dumpCheckWindow = 4096
+
+// checkTextDump reads a text dump from r and checks that its first bytes
+// contain one of banners and its last bytes contain trailer
+func checkTextDump(r io.Reader, banners []string, trailer string) error {
+	edges := &dumpEdges{}
+	if _, err := io.Copy(edges, r); err != nil {
+		return err
+	}
+
+	if edges.size == 0 {
+		return fmt.Errorf("dump is empty")
+	}
+
+	found := false
+	for _, banner := range banners {
+		if bytes.Contains(edges.head, []byte(banner)) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("dump does not start with a %q banner", banners[0])
+	}
+
+	if !bytes.Contains(edges.tail, []byte(trailer)) {
+		return fmt.Errorf("dump is incomplete: missing %q trailer", trailer)
+	}
+	return nil
+}
+
+// dumpEdges keeps the first and last dumpCheckWindow bytes written to it
+type dumpEdges struct {
+	head []byte
+	tail []byte
+	size int64
+}
+
+func (d *dumpEdges) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	if missing := dumpCheckWindow - len(d.head); missing > 0 {
+		d.head = append(d.head, p[:min(missing, len(p))]...)
+	}
+	d.tail = append(d.tail, p...)
+	if len(d.tail) > dumpCheckWindow {
+		d.tail = append(d.tail[:0], d.tail[len(d.tail)-dumpCheckWindow:]...)
+	}
+	return len(p), nil
+}
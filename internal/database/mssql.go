@@ -0,0 +1,620 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	mssql "github.com/microsoft/go-mssqldb"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+// mssqlDumpDir is the folder of the SQL Server dump in the backup archive. It
+// holds a data file per table and their table of contents.
+const mssqlDumpDir = "dump.mssql"
+
+// mssqlTOC is the table of contents of a SQL Server dump. Each line between
+// its banner and trailer names a data file, the table it holds and its
+// number of rows, separated by tabs. It is written last, so that its trailer
+// tells that the dump is complete.
+const mssqlTOC = "toc.txt"
+
+const (
+	mssqlTOCBanner  = "-- Gitea MSSQL dump"
+	mssqlTOCTrailer = "-- Dump completed"
+)
+
+// mssqlListColumns lists the columns of the tables of the database, by
+// quoted schema.table name
+const mssqlListColumns = "SELECT QUOTENAME(c.TABLE_SCHEMA) + '.' + QUOTENAME(c.TABLE_NAME), c.COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS c JOIN INFORMATION_SCHEMA.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME WHERE t.TABLE_TYPE = 'BASE TABLE' ORDER BY 1, c.ORDINAL_POSITION"
+
+// mssqlMaxParams is the number of parameters a single insert is kept under,
+// SQL Server accepting up to 2100
+const mssqlMaxParams = 2000
+
+// mssqlMaxInsertRows is the number of rows SQL Server accepts in the VALUES
+// of a single insert
+const mssqlMaxInsertRows = 1000
+
+// mssqlTableName matches the quoted schema.table names of the table of
+// contents
+var mssqlTableName = regexp.MustCompile(`^\[(?:[^\]]|\]\])+\]\.\[(?:[^\]]|\]\])+\]$`)
+
+// mssqlDriver is the database/sql driver the adapter connects with
+var mssqlDriver = "sqlserver"
+
+// mssqlEmptyBinary stands for an empty binary value in a data file, as gob
+// decodes empty byte slices as nil ones, which would be inserted as NULL
+type mssqlEmptyBinary bool
+
+func init() {
+	// Rows are written with gob, which needs the types held by interfaces
+	gob.Register(time.Time{})
+	gob.Register(mssqlEmptyBinary(true))
+}
+
+// MSSQLAdapter implements DatabaseAdapter for Microsoft SQL Server with the
+// go-mssqldb driver, so that no client tool is needed and the password never
+// shows on a command line. The rows of every table are exported with gob
+// inside a single snapshot transaction. The schema is not part of the dump:
+// Gitea creates it, so the tables must exist when restoring.
+type MSSQLAdapter struct {
+	// TrustServerCertificate skips the validation of the server certificate
+	TrustServerCertificate bool
+}
+
+func (m *MSSQLAdapter) Backup(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	dir := filepath.Join(settings.BackupTmpFolder, mssqlDumpDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove previous dump: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create dump folder: %w", err)
+	}
+
+	ctx := context.Background()
+	db, err := m.open(ctx, giteaConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := beginMSSQLSnapshot(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tables, err := listMSSQLColumns(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	var toc strings.Builder
+	toc.WriteString(mssqlTOCBanner + "\n")
+	for i, table := range slices.Sorted(maps.Keys(tables)) {
+		dataFile := fmt.Sprintf("%04d.gob", i+1)
+
+		logger.Debugf("Exporting table %s", table)
+		count, err := exportMSSQLTable(ctx, tx, table, filepath.Join(dir, dataFile))
+		if err != nil {
+			return fmt.Errorf("failed to export table %s: %w", table, err)
+		}
+		fmt.Fprintf(&toc, "%s\t%s\t%d\n", dataFile, table, count)
+	}
+	toc.WriteString(mssqlTOCTrailer + "\n")
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to end snapshot transaction: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, mssqlTOC), []byte(toc.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write table of contents: %w", err)
+	}
+
+	logger.Infof("MSSQL database backup completed, %d tables exported", len(tables))
+	return nil
+}
+
+// DumpName returns the name of the dump in the backup archive, which goes by
+// its table of contents
+func (m *MSSQLAdapter) DumpName() string {
+	return mssqlDumpDir + "/" + mssqlTOC
+}
+
+// CheckDump checks that r holds the complete table of contents of a dump
+func (m *MSSQLAdapter) CheckDump(r io.Reader) error {
+	return checkTextDump(r, []string{mssqlTOCBanner}, mssqlTOCTrailer)
+}
+
+// Restore replaces the rows of the tables of the dump in a single
+// transaction, keeping identity values. The dump holds no schema: Gitea must
+// have created the tables first. Nothing is changed unless every data file
+// is there and the tables of the database match the dump.
+func (m *MSSQLAdapter) Restore(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	dir := filepath.Join(settings.RestoreTmpFolder, mssqlDumpDir)
+	entries, err := readMSSQLTOC(filepath.Join(dir, mssqlTOC))
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string][]string, len(entries))
+	for _, entry := range entries {
+		header, err := readMSSQLHeader(filepath.Join(dir, entry.dataFile))
+		if err != nil {
+			return fmt.Errorf("invalid data file for table %s: %w", entry.table, err)
+		}
+		columns[entry.table] = header.Columns
+	}
+
+	ctx := context.Background()
+	db, err := m.open(ctx, giteaConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	live, err := listMSSQLColumns(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := checkMSSQLTables(columns, live); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+entry.table); err != nil {
+			return fmt.Errorf("failed to empty table %s: %w", entry.table, err)
+		}
+	}
+	for _, entry := range entries {
+		logger.Debugf("Importing table %s", entry.table)
+		if err := importMSSQLTable(ctx, tx, entry, filepath.Join(dir, entry.dataFile)); err != nil {
+			return fmt.Errorf("failed to import table %s: %w", entry.table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit restore: %w", err)
+	}
+
+	logger.Infof("MSSQL database restore completed, %d tables imported", len(entries))
+	return nil
+}
+
+// open connects to the Gitea database
+func (m *MSSQLAdapter) open(ctx context.Context, giteaConfig *config.GiteaConfig) (*sql.DB, error) {
+	db, err := sql.Open(mssqlDriver, m.connectionURL(giteaConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// connectionURL returns the go-mssqldb connection string of the Gitea
+// database, with its credentials
+func (m *MSSQLAdapter) connectionURL(giteaConfig *config.GiteaConfig) string {
+	host, port := parseHostPort(giteaConfig.Database.Host)
+	if port != "" {
+		host += ":" + port
+	}
+	query := url.Values{}
+	query.Set("database", giteaConfig.Database.Name)
+	if m.TrustServerCertificate {
+		query.Set("TrustServerCertificate", "true")
+	}
+
+	u := &url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(giteaConfig.Database.User, giteaConfig.Database.Passwd),
+		Host:     host,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// beginMSSQLSnapshot starts the transaction the dump is read in. It uses
+// snapshot isolation when the database allows it, and serializable isolation,
+// which holds back writes until the dump is done, otherwise.
+func beginMSSQLSnapshot(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	var state int
+	if err := db.QueryRowContext(ctx, "SELECT snapshot_isolation_state FROM sys.databases WHERE name = DB_NAME()").Scan(&state); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot isolation state: %w", err)
+	}
+
+	isolation := sql.LevelSnapshot
+	if state != 1 {
+		logger.Warnf("Snapshot isolation is not allowed on the database, Gitea writes wait until the backup is done; set ALLOW_SNAPSHOT_ISOLATION ON to avoid it")
+		isolation = sql.LevelSerializable
+	}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: isolation})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start snapshot transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// listMSSQLColumns returns the columns of every table of the database, by
+// quoted schema.table name
+func listMSSQLColumns(ctx context.Context, tx *sql.Tx) (map[string][]string, error) {
+	rows, err := tx.QueryContext(ctx, mssqlListColumns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	tables := make(map[string][]string)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		tables[table] = append(tables[table], column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	return tables, nil
+}
+
+// checkMSSQLTables checks that the database has the tables of the dump, and
+// no others, and that they have every column of the dump
+func checkMSSQLTables(dump, live map[string][]string) error {
+	var problems []string
+	for _, table := range slices.Sorted(maps.Keys(dump)) {
+		liveColumns, ok := live[table]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("table %s of the dump does not exist", table))
+			continue
+		}
+		for _, column := range dump[table] {
+			if !slices.Contains(liveColumns, column) {
+				problems = append(problems, fmt.Sprintf("column %s of table %s does not exist", column, table))
+			}
+		}
+	}
+	for _, table := range slices.Sorted(maps.Keys(live)) {
+		if _, ok := dump[table]; !ok {
+			problems = append(problems, fmt.Sprintf("table %s is not in the dump", table))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("the database does not match the dump, start the Gitea version the backup was made with on it to create its schema: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// mssqlHeader starts a data file, naming the columns of the rows that follow
+type mssqlHeader struct {
+	Columns []string
+}
+
+// exportMSSQLTable writes the rows of table to the data file at path and
+// returns how many there are
+func exportMSSQLTable(ctx context.Context, tx *sql.Tx, table, path string) (int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT * FROM "+table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	header := mssqlHeader{Columns: make([]string, len(columnTypes))}
+	for i, columnType := range columnTypes {
+		header.Columns[i] = columnType.Name()
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	data, err := newMSSQLDataWriter(file, header)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	values := make([]any, len(columnTypes))
+	pointers := make([]any, len(columnTypes))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return 0, err
+		}
+		for i, columnType := range columnTypes {
+			if values[i], err = mssqlExportValue(columnType.DatabaseTypeName(), values[i]); err != nil {
+				return 0, fmt.Errorf("column %s: %w", columnType.Name(), err)
+			}
+		}
+		if err := data.Write(values); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := data.Flush(); err != nil {
+		return 0, err
+	}
+	return count, file.Close()
+}
+
+// mssqlExportValue returns value, read from a column of type typeName, in a
+// form SQL Server converts back to the column type when inserted. The driver
+// reads decimals and unique identifiers as bytes, which would be inserted as
+// binary.
+func mssqlExportValue(typeName string, value any) (any, error) {
+	data, ok := value.([]byte)
+	if !ok {
+		return value, nil
+	}
+	switch typeName {
+	case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY":
+		return string(data), nil
+	case "UNIQUEIDENTIFIER":
+		var id mssql.UniqueIdentifier
+		if err := id.Scan(data); err != nil {
+			return nil, err
+		}
+		return id.String(), nil
+	}
+	return data, nil
+}
+
+// mssqlDataWriter writes a data file: the header, then a gob encoded slice
+// of values per row
+type mssqlDataWriter struct {
+	writer  *bufio.Writer
+	encoder *gob.Encoder
+}
+
+func newMSSQLDataWriter(w io.Writer, header mssqlHeader) (*mssqlDataWriter, error) {
+	writer := bufio.NewWriter(w)
+	encoder := gob.NewEncoder(writer)
+	if err := encoder.Encode(header); err != nil {
+		return nil, err
+	}
+	return &mssqlDataWriter{writer: writer, encoder: encoder}, nil
+}
+
+// Write adds a row
+func (d *mssqlDataWriter) Write(values []any) error {
+	row := make([]any, len(values))
+	for i, value := range values {
+		if data, ok := value.([]byte); ok && data != nil && len(data) == 0 {
+			value = mssqlEmptyBinary(true)
+		}
+		row[i] = value
+	}
+	return d.encoder.Encode(row)
+}
+
+// Flush writes any buffered row
+func (d *mssqlDataWriter) Flush() error {
+	return d.writer.Flush()
+}
+
+// mssqlDataReader reads the rows of a data file
+type mssqlDataReader struct {
+	decoder *gob.Decoder
+	header  mssqlHeader
+}
+
+func newMSSQLDataReader(r io.Reader) (*mssqlDataReader, error) {
+	decoder := gob.NewDecoder(bufio.NewReader(r))
+	var header mssqlHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if len(header.Columns) == 0 {
+		return nil, errors.New("no columns in header")
+	}
+	return &mssqlDataReader{decoder: decoder, header: header}, nil
+}
+
+// Next returns the next row, or io.EOF after the last one
+func (d *mssqlDataReader) Next() ([]any, error) {
+	var values []any
+	if err := d.decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	if len(values) != len(d.header.Columns) {
+		return nil, fmt.Errorf("row has %d values for %d columns", len(values), len(d.header.Columns))
+	}
+	for i, value := range values {
+		if _, ok := value.(mssqlEmptyBinary); ok {
+			values[i] = []byte{}
+		}
+	}
+	return values, nil
+}
+
+// readMSSQLHeader reads the header of the data file at path
+func readMSSQLHeader(path string) (*mssqlHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := newMSSQLDataReader(file)
+	if err != nil {
+		return nil, err
+	}
+	return &data.header, nil
+}
+
+// importMSSQLTable inserts the rows of the data file at path into the table
+// of entry, several rows per statement
+func importMSSQLTable(ctx context.Context, tx *sql.Tx, entry mssqlTOCEntry, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := newMSSQLDataReader(file)
+	if err != nil {
+		return err
+	}
+	header := data.header
+
+	var hasIdentity bool
+	if err := tx.QueryRowContext(ctx, "SELECT CAST(OBJECTPROPERTY(OBJECT_ID(@p1), 'TableHasIdentity') AS bit)", entry.table).Scan(&hasIdentity); err != nil {
+		return err
+	}
+	if hasIdentity {
+		if _, err := tx.ExecContext(ctx, "SET IDENTITY_INSERT "+entry.table+" ON"); err != nil {
+			return err
+		}
+	}
+
+	quoted := make([]string, len(header.Columns))
+	for i, column := range header.Columns {
+		quoted[i] = mssqlQuoteName(column)
+	}
+	insert := "INSERT INTO " + entry.table + " (" + strings.Join(quoted, ", ") + ") VALUES "
+	batchSize := min(mssqlMaxInsertRows, max(1, mssqlMaxParams/len(header.Columns)))
+
+	count := 0
+	var batch []any
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var query strings.Builder
+		query.WriteString(insert)
+		for row := 0; row < len(batch)/len(header.Columns); row++ {
+			if row > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString("(")
+			for i := range header.Columns {
+				if i > 0 {
+					query.WriteString(", ")
+				}
+				query.WriteString("@p" + strconv.Itoa(row*len(header.Columns)+i+1))
+			}
+			query.WriteString(")")
+		}
+		if _, err := tx.ExecContext(ctx, query.String(), batch...); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		values, err := data.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("row %d: %w", count+1, err)
+		}
+		batch = append(batch, values...)
+		count++
+		if count%batchSize == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if count != entry.rows {
+		return fmt.Errorf("data file holds %d rows, %d expected", count, entry.rows)
+	}
+
+	if hasIdentity {
+		if _, err := tx.ExecContext(ctx, "SET IDENTITY_INSERT "+entry.table+" OFF"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mssqlTOCEntry is a line of the table of contents of a dump
+type mssqlTOCEntry struct {
+	dataFile string
+	table    string
+	rows     int
+}
+
+// readMSSQLTOC reads the table of contents at path, which must be complete
+func readMSSQLTOC(path string) ([]mssqlTOCEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open table of contents: %w", err)
+	}
+	defer file.Close()
+
+	if err := checkTextDump(file, []string{mssqlTOCBanner}, mssqlTOCTrailer); err != nil {
+		return nil, fmt.Errorf("invalid table of contents: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var entries []mssqlTOCEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || filepath.Base(fields[0]) != fields[0] || !mssqlTableName.MatchString(fields[1]) {
+			return nil, fmt.Errorf("invalid table of contents line: %q", line)
+		}
+		rows, err := strconv.Atoi(fields[2])
+		if err != nil || rows < 0 {
+			return nil, fmt.Errorf("invalid table of contents line: %q", line)
+		}
+		entries = append(entries, mssqlTOCEntry{dataFile: fields[0], table: fields[1], rows: rows})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read table of contents: %w", err)
+	}
+	return entries, nil
+}
+
+// mssqlQuoteName returns s as a bracketed SQL Server identifier
+func mssqlQuoteName(s string) string {
+	return "[" + strings.ReplaceAll(s, "]", "]]") + "]"
+}
@@ -0,0 +1,619 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+var mssqlGiteaConfig = &config.GiteaConfig{Database: config.DatabaseConfig{
+	DBType: "mssql",
+	Host:   "sqlserver:1433",
+	Name:   "gitea",
+	User:   "sa",
+	Passwd: "Secret123!",
+}}
+
+// writeMSSQLDump writes a complete table of contents with lines into the
+// dump folder of dir
+func writeMSSQLDump(t *testing.T, dir string, lines ...string) {
+	t.Helper()
+	dumpDir := filepath.Join(dir, "dump.mssql")
+	if err := os.MkdirAll(dumpDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	toc := "-- Gitea MSSQL dump\n" + strings.Join(lines, "\n") + "\n-- Dump completed\n"
+	if err := os.WriteFile(filepath.Join(dumpDir, "toc.txt"), []byte(toc), 0644); err != nil {
+		t.Fatalf("Failed to create table of contents: %v", err)
+	}
+}
+
+func TestMSSQLAdapter_ConnectionURL(t *testing.T) {
+	raw := (&MSSQLAdapter{TrustServerCertificate: true}).connectionURL(mssqlGiteaConfig)
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("Invalid connection URL %q: %v", raw, err)
+	}
+	password, _ := u.User.Password()
+	if u.Scheme != "sqlserver" || u.Host != "sqlserver:1433" || u.User.Username() != "sa" || password != "Secret123!" {
+		t.Errorf("Unexpected connection URL %q", raw)
+	}
+	if u.Query().Get("database") != "gitea" || u.Query().Get("TrustServerCertificate") != "true" {
+		t.Errorf("Unexpected connection parameters %q", u.RawQuery)
+	}
+
+	raw = (&MSSQLAdapter{}).connectionURL(mssqlGiteaConfig)
+	if strings.Contains(raw, "TrustServerCertificate") {
+		t.Errorf("Expected the server certificate to be validated, got %q", raw)
+	}
+}
+
+func TestMSSQLData_RoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	rows := [][]any{
+		{int64(1), "alice", []byte{0x00, 0xff}, true, 1.5, created},
+		{int64(2), nil, nil, false, nil, nil},
+		{int64(3), "", []byte{}, false, 0.0, created},
+	}
+
+	var buf bytes.Buffer
+	writer, err := newMSSQLDataWriter(&buf, mssqlHeader{Columns: []string{"id", "name", "avatar", "is_admin", "score", "created"}})
+	if err != nil {
+		t.Fatalf("Failed to write header: %v", err)
+	}
+	for _, row := range rows {
+		if err := writer.Write(row); err != nil {
+			t.Fatalf("Failed to write row: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	reader, err := newMSSQLDataReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+	if len(reader.header.Columns) != 6 || reader.header.Columns[5] != "created" {
+		t.Errorf("Unexpected header: %v", reader.header)
+	}
+	for i, want := range rows {
+		got, err := reader.Next()
+		if err != nil {
+			t.Fatalf("Failed to read row %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Row %d: expected %v, got %v", i, want, got)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last row, got %v", err)
+	}
+}
+
+func TestMSSQLExportValue(t *testing.T) {
+	// SQL Server stores unique identifiers with their first groups reversed
+	id := []byte{0x67, 0x45, 0x23, 0x01, 0xab, 0x89, 0xef, 0xcd, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	tests := []struct {
+		typeName string
+		value    any
+		want     any
+	}{
+		{"DECIMAL", []byte("12.50"), "12.50"},
+		{"MONEY", []byte("3.0000"), "3.0000"},
+		{"UNIQUEIDENTIFIER", id, "01234567-89AB-CDEF-0123-456789ABCDEF"},
+		{"VARBINARY", []byte{0x01}, []byte{0x01}},
+		{"BIGINT", int64(7), int64(7)},
+		{"DECIMAL", nil, nil},
+	}
+	for _, tt := range tests {
+		got, err := mssqlExportValue(tt.typeName, tt.value)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mssqlExportValue(%s, %v) = %v, %v, expected %v", tt.typeName, tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestCheckMSSQLTables(t *testing.T) {
+	dump := map[string][]string{
+		"[dbo].[repository]": {"id", "name"},
+		"[dbo].[user]":       {"id", "name"},
+	}
+
+	live := map[string][]string{
+		"[dbo].[repository]": {"id", "name", "added_later"},
+		"[dbo].[user]":       {"id", "name"},
+	}
+	if err := checkMSSQLTables(dump, live); err != nil {
+		t.Errorf("Expected matching tables, got %v", err)
+	}
+
+	live = map[string][]string{
+		"[dbo].[repository]": {"id"},
+		"[dbo].[action]":     {"id"},
+	}
+	err := checkMSSQLTables(dump, live)
+	if err == nil {
+		t.Fatal("Expected error for mismatched tables, got nil")
+	}
+	for _, want := range []string{
+		"column name of table [dbo].[repository] does not exist",
+		"table [dbo].[user] of the dump does not exist",
+		"table [dbo].[action] is not in the dump",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestMSSQLAdapter_RestoreIncompleteDump(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "dump.mssql"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "dump.mssql", "toc.txt"), []byte("-- Gitea MSSQL dump\n0001.gob\t[dbo].[user]\t1\n"), 0644); err != nil {
+		t.Fatalf("Failed to create table of contents: %v", err)
+	}
+
+	err := (&MSSQLAdapter{}).Restore(&config.Settings{RestoreTmpFolder: tmpDir}, mssqlGiteaConfig)
+	if err == nil || !strings.Contains(err.Error(), "incomplete") {
+		t.Errorf("Expected an incomplete dump error, got %v", err)
+	}
+}
+
+func TestMSSQLAdapter_RestoreMissingDataFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeMSSQLDump(t, tmpDir, "0001.gob\t[dbo].[user]\t1")
+
+	// The data files are checked before connecting to the database
+	err := (&MSSQLAdapter{}).Restore(&config.Settings{RestoreTmpFolder: tmpDir}, mssqlGiteaConfig)
+	if err == nil || !strings.Contains(err.Error(), "invalid data file for table [dbo].[user]") {
+		t.Errorf("Expected a missing data file error, got %v", err)
+	}
+}
+
+func TestReadMSSQLTOC(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeMSSQLDump(t, tmpDir, "0001.gob\t[dbo].[repository]\t0", "0002.gob\t[dbo].[user]\t42")
+
+	entries, err := readMSSQLTOC(filepath.Join(tmpDir, "dump.mssql", "toc.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read table of contents: %v", err)
+	}
+	want := []mssqlTOCEntry{
+		{dataFile: "0001.gob", table: "[dbo].[repository]", rows: 0},
+		{dataFile: "0002.gob", table: "[dbo].[user]", rows: 42},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Expected %v, got %v", want, entries)
+	}
+}
+
+func TestReadMSSQLTOC_RejectsInvalidNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, line := range []string{
+		"../0001.gob\t[dbo].[user]\t1",
+		"0001.gob\t[dbo].[user]; DROP TABLE x\t1",
+		"0001.gob\t[dbo].[user]",
+		"0001.gob\t[dbo].[user]\t-1",
+		"0001.gob",
+	} {
+		writeMSSQLDump(t, tmpDir, line)
+		if _, err := readMSSQLTOC(filepath.Join(tmpDir, "dump.mssql", "toc.txt")); err == nil {
+			t.Errorf("Expected %q to be rejected", line)
+		}
+	}
+}
+
+// fakeMSSQLServer is an in-memory stand-in for SQL Server behind the
+// fakemssql database/sql driver. It understands the statements of the
+// adapter only.
+type fakeMSSQLServer struct {
+	mu          sync.Mutex
+	tables      map[string]*fakeMSSQLTable
+	snapshot    bool
+	isolation   driver.IsolationLevel
+	inserts     map[string]int
+	identityLog []string
+	// failInsert makes inserts into this table fail
+	failInsert string
+}
+
+type fakeMSSQLTable struct {
+	columns  []string
+	types    []string
+	notNull  []bool
+	identity bool
+	rows     [][]driver.Value
+}
+
+func (t *fakeMSSQLTable) clone() *fakeMSSQLTable {
+	c := *t
+	c.rows = slices.Clone(t.rows)
+	return &c
+}
+
+var (
+	fakeMSSQLMu      sync.Mutex
+	fakeMSSQLServers = map[string]*fakeMSSQLServer{}
+)
+
+func init() {
+	sql.Register("fakemssql", fakeMSSQLDriver{})
+}
+
+// useFakeMSSQLServer connects the adapter to server for the test
+func useFakeMSSQLServer(t *testing.T, adapter *MSSQLAdapter, giteaConfig *config.GiteaConfig, server *fakeMSSQLServer) {
+	t.Helper()
+	dsn := adapter.connectionURL(giteaConfig)
+	fakeMSSQLMu.Lock()
+	fakeMSSQLServers[dsn] = server
+	fakeMSSQLMu.Unlock()
+
+	driverName := mssqlDriver
+	mssqlDriver = "fakemssql"
+	t.Cleanup(func() {
+		mssqlDriver = driverName
+		fakeMSSQLMu.Lock()
+		delete(fakeMSSQLServers, dsn)
+		fakeMSSQLMu.Unlock()
+	})
+}
+
+type fakeMSSQLDriver struct{}
+
+func (fakeMSSQLDriver) Open(dsn string) (driver.Conn, error) {
+	fakeMSSQLMu.Lock()
+	defer fakeMSSQLMu.Unlock()
+	server, ok := fakeMSSQLServers[dsn]
+	if !ok {
+		return nil, fmt.Errorf("no fake server for %s", dsn)
+	}
+	return &fakeMSSQLConn{server: server}, nil
+}
+
+// fakeMSSQLConn is a session. Within a transaction, it works on a copy of
+// the tables that replaces them on commit.
+type fakeMSSQLConn struct {
+	server         *fakeMSSQLServer
+	tx             map[string]*fakeMSSQLTable
+	identityInsert string
+}
+
+var (
+	fakeMSSQLSelectAll = regexp.MustCompile(`^SELECT \* FROM (\S+)$`)
+	fakeMSSQLDelete    = regexp.MustCompile(`^DELETE FROM (\S+)$`)
+	fakeMSSQLIdentity  = regexp.MustCompile(`^SET IDENTITY_INSERT (\S+) (ON|OFF)$`)
+	fakeMSSQLInsert    = regexp.MustCompile(`^INSERT INTO (\S+) \((.+?)\) VALUES `)
+)
+
+func (c *fakeMSSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeMSSQLConn) Close() error { return nil }
+
+func (c *fakeMSSQLConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeMSSQLConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if driver.IsolationLevel(sql.LevelSnapshot) == opts.Isolation && !c.server.snapshot {
+		return nil, errors.New("snapshot isolation transaction failed accessing database")
+	}
+	c.server.isolation = opts.Isolation
+	c.tx = make(map[string]*fakeMSSQLTable, len(c.server.tables))
+	for name, table := range c.server.tables {
+		c.tx[name] = table.clone()
+	}
+	return c, nil
+}
+
+func (c *fakeMSSQLConn) Commit() error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	c.server.tables, c.tx = c.tx, nil
+	return nil
+}
+
+func (c *fakeMSSQLConn) Rollback() error {
+	c.tx = nil
+	return nil
+}
+
+func (c *fakeMSSQLConn) table(name string) (*fakeMSSQLTable, error) {
+	tables := c.tx
+	if tables == nil {
+		tables = c.server.tables
+	}
+	table, ok := tables[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid object name '%s'", name)
+	}
+	return table, nil
+}
+
+func (c *fakeMSSQLConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "SELECT snapshot_isolation_state"):
+		state := int64(0)
+		if c.server.snapshot {
+			state = 1
+		}
+		return &fakeMSSQLRows{columns: []string{"snapshot_isolation_state"}, rows: [][]driver.Value{{state}}}, nil
+
+	case query == mssqlListColumns:
+		rows := &fakeMSSQLRows{columns: []string{"table", "column"}}
+		for _, name := range slices.Sorted(maps.Keys(c.tx)) {
+			for _, column := range c.tx[name].columns {
+				rows.rows = append(rows.rows, []driver.Value{name, column})
+			}
+		}
+		return rows, nil
+
+	case strings.HasPrefix(query, "SELECT CAST(OBJECTPROPERTY"):
+		table, err := c.table(args[0].Value.(string))
+		if err != nil {
+			return nil, err
+		}
+		return &fakeMSSQLRows{columns: []string{""}, rows: [][]driver.Value{{table.identity}}}, nil
+
+	case fakeMSSQLSelectAll.MatchString(query):
+		table, err := c.table(fakeMSSQLSelectAll.FindStringSubmatch(query)[1])
+		if err != nil {
+			return nil, err
+		}
+		return &fakeMSSQLRows{columns: table.columns, types: table.types, rows: table.rows}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+func (c *fakeMSSQLConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	if match := fakeMSSQLDelete.FindStringSubmatch(query); match != nil {
+		table, err := c.table(match[1])
+		if err != nil {
+			return nil, err
+		}
+		table.rows = nil
+		return driver.RowsAffected(0), nil
+	}
+
+	if match := fakeMSSQLIdentity.FindStringSubmatch(query); match != nil {
+		c.server.identityLog = append(c.server.identityLog, match[1]+" "+match[2])
+		c.identityInsert = ""
+		if match[2] == "ON" {
+			c.identityInsert = match[1]
+		}
+		return driver.RowsAffected(0), nil
+	}
+
+	if match := fakeMSSQLInsert.FindStringSubmatch(query); match != nil {
+		name := match[1]
+		table, err := c.table(name)
+		if err != nil {
+			return nil, err
+		}
+		if name == c.server.failInsert {
+			return nil, errors.New("conversion failed")
+		}
+
+		var columns []int
+		for _, column := range strings.Split(match[2], ", ") {
+			column = strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(column, "["), "]"), "]]", "]")
+			i := slices.Index(table.columns, column)
+			if i < 0 {
+				return nil, fmt.Errorf("invalid column name '%s'", column)
+			}
+			if table.identity && i == 0 && c.identityInsert != name {
+				return nil, fmt.Errorf("cannot insert explicit value for identity column in table '%s' when IDENTITY_INSERT is set to OFF", name)
+			}
+			columns = append(columns, i)
+		}
+		if len(args)%len(columns) != 0 || strings.Count(query, "(") != len(args)/len(columns)+1 {
+			return nil, fmt.Errorf("malformed insert %q", query)
+		}
+
+		for start := 0; start < len(args); start += len(columns) {
+			row := make([]driver.Value, len(table.columns))
+			for j, i := range columns {
+				value := args[start+j].Value
+				// go-mssqldb sends nil byte slices as NULL
+				if data, ok := value.([]byte); ok && data == nil {
+					value = nil
+				}
+				if value == nil && table.notNull[i] {
+					return nil, fmt.Errorf("cannot insert NULL into column '%s'", table.columns[i])
+				}
+				// Strings are converted back to decimals
+				if s, ok := value.(string); ok && table.types[i] == "DECIMAL" {
+					value = []byte(s)
+				}
+				row[i] = value
+			}
+			table.rows = append(table.rows, row)
+		}
+		c.server.inserts[name]++
+		return driver.RowsAffected(len(args) / len(columns)), nil
+	}
+
+	return nil, fmt.Errorf("unexpected statement %q", query)
+}
+
+type fakeMSSQLRows struct {
+	columns []string
+	types   []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeMSSQLRows) Columns() []string { return r.columns }
+
+func (r *fakeMSSQLRows) Close() error { return nil }
+
+func (r *fakeMSSQLRows) ColumnTypeDatabaseTypeName(i int) string {
+	if r.types == nil {
+		return ""
+	}
+	return r.types[i]
+}
+
+func (r *fakeMSSQLRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// newFakeGiteaMSSQL returns a server with a user table whose identity
+// column and empty avatars must survive a restore, and a repository table
+// large enough to be inserted in several batches
+func newFakeGiteaMSSQL() *fakeMSSQLServer {
+	users := &fakeMSSQLTable{
+		columns:  []string{"id", "name", "avatar", "balance"},
+		types:    []string{"BIGINT", "NVARCHAR", "VARBINARY", "DECIMAL"},
+		notNull:  []bool{true, true, true, false},
+		identity: true,
+		rows: [][]driver.Value{
+			{int64(1), "alice", []byte{0x89, 0x50}, []byte("12.50")},
+			{int64(5), "bob", []byte{}, nil},
+		},
+	}
+	repos := &fakeMSSQLTable{
+		columns: []string{"owner_id", "name", "is_private"},
+		types:   []string{"BIGINT", "NVARCHAR", "BIT"},
+		notNull: []bool{true, true, true},
+	}
+	// 3 columns make batches of 666 rows
+	for i := 0; i < 1500; i++ {
+		repos.rows = append(repos.rows, []driver.Value{int64(i % 7), fmt.Sprintf("repo-%d", i), i%2 == 0})
+	}
+
+	return &fakeMSSQLServer{
+		tables:   map[string]*fakeMSSQLTable{"[dbo].[user]": users, "[dbo].[repository]": repos},
+		snapshot: true,
+		inserts:  map[string]int{},
+	}
+}
+
+func TestMSSQLAdapter_BackupRestore(t *testing.T) {
+	server := newFakeGiteaMSSQL()
+	adapter := &MSSQLAdapter{}
+	useFakeMSSQLServer(t, adapter, mssqlGiteaConfig, server)
+	tmpDir := t.TempDir()
+	settings := &config.Settings{BackupTmpFolder: tmpDir, RestoreTmpFolder: tmpDir}
+
+	if err := adapter.Backup(settings, mssqlGiteaConfig); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if server.isolation != driver.IsolationLevel(sql.LevelSnapshot) {
+		t.Errorf("Expected the backup to read a snapshot, got isolation level %d", server.isolation)
+	}
+	toc, err := os.ReadFile(filepath.Join(tmpDir, adapter.DumpName()))
+	if err != nil {
+		t.Fatalf("Expected a table of contents: %v", err)
+	}
+	if !strings.Contains(string(toc), "0001.gob\t[dbo].[repository]\t1500\n0002.gob\t[dbo].[user]\t2\n") {
+		t.Errorf("Unexpected table of contents:\n%s", toc)
+	}
+
+	want := map[string][][]driver.Value{}
+	for name, table := range server.tables {
+		want[name] = table.rows
+	}
+	server.tables["[dbo].[user]"].rows = [][]driver.Value{{int64(9), "mallory", []byte{0x01}, nil}}
+	server.tables["[dbo].[repository]"].rows = nil
+
+	if err := adapter.Restore(settings, mssqlGiteaConfig); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	for name, rows := range want {
+		if got := server.tables[name].rows; !reflect.DeepEqual(got, rows) {
+			t.Errorf("Table %s: expected %d restored rows, got %d: %v", name, len(rows), len(got), got[:min(len(got), 3)])
+		}
+	}
+	if server.inserts["[dbo].[repository]"] != 3 || server.inserts["[dbo].[user]"] != 1 {
+		t.Errorf("Expected the rows to be inserted in batches, got %v", server.inserts)
+	}
+	if strings.Join(server.identityLog, ", ") != "[dbo].[user] ON, [dbo].[user] OFF" {
+		t.Errorf("Expected IDENTITY_INSERT around the user table only, got %v", server.identityLog)
+	}
+}
+
+func TestMSSQLAdapter_BackupWithoutSnapshotIsolation(t *testing.T) {
+	server := newFakeGiteaMSSQL()
+	server.snapshot = false
+	adapter := &MSSQLAdapter{}
+	useFakeMSSQLServer(t, adapter, mssqlGiteaConfig, server)
+
+	if err := adapter.Backup(&config.Settings{BackupTmpFolder: t.TempDir()}, mssqlGiteaConfig); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if server.isolation != driver.IsolationLevel(sql.LevelSerializable) {
+		t.Errorf("Expected a serializable transaction, got isolation level %d", server.isolation)
+	}
+}
+
+func TestMSSQLAdapter_RestoreLeavesDatabaseOnFailure(t *testing.T) {
+	server := newFakeGiteaMSSQL()
+	adapter := &MSSQLAdapter{}
+	useFakeMSSQLServer(t, adapter, mssqlGiteaConfig, server)
+	tmpDir := t.TempDir()
+	settings := &config.Settings{BackupTmpFolder: tmpDir, RestoreTmpFolder: tmpDir}
+	if err := adapter.Backup(settings, mssqlGiteaConfig); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	current := []driver.Value{int64(9), "mallory", []byte{0x01}, nil}
+	server.tables["[dbo].[user]"].rows = [][]driver.Value{current}
+
+	// The user table is emptied before the import fails
+	server.failInsert = "[dbo].[user]"
+	if err := adapter.Restore(settings, mssqlGiteaConfig); err == nil || !strings.Contains(err.Error(), "conversion failed") {
+		t.Fatalf("Expected the import error, got %v", err)
+	}
+	if rows := server.tables["[dbo].[user]"].rows; len(rows) != 1 || !reflect.DeepEqual(rows[0], current) {
+		t.Errorf("Expected the user table to be left as it was, got %v", rows)
+	}
+	if len(server.tables["[dbo].[repository]"].rows) != 1500 {
+		t.Error("Expected the repository table to be left as it was")
+	}
+
+	// Tables missing from the database stop the restore before any change
+	server.failInsert = ""
+	delete(server.tables, "[dbo].[repository]")
+	err := adapter.Restore(settings, mssqlGiteaConfig)
+	if err == nil || !strings.Contains(err.Error(), "table [dbo].[repository] of the dump does not exist") {
+		t.Fatalf("Expected a missing table error, got %v", err)
+	}
+	if rows := server.tables["[dbo].[user]"].rows; len(rows) != 1 {
+		t.Errorf("Expected the user table to be left as it was, got %v", rows)
+	}
+}
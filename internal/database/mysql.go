@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -11,24 +12,66 @@ import (
 	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
 )
 
+// mysqlDefaultCharset is the character set of Gitea databases when app.ini
+// does not set CHARSET
+const mysqlDefaultCharset = "utf8mb4"
+
 // MySQLAdapter implements DatabaseAdapter for MySQL
-type MySQLAdapter struct{}
+type MySQLAdapter struct {
+	// Routines adds the stored routines and events to the dump
+	Routines bool
+}
 
 func (m *MySQLAdapter) Backup(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	outputFile := filepath.Join(settings.BackupTmpFolder, m.DumpName())
+	
+	// Redirect output to file
+	outFile, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+	
+	if err := m.Dump(outFile, giteaConfig); err != nil {
+		return err
+	}
+	
+	logger.Info("MySQL database backup completed")
+	return nil
+}
+
+// DumpName returns the name of the dump in the backup archive
+func (m *MySQLAdapter) DumpName() string {
+	return "dump.mysql.sql"
+}
+
+// Dump writes a mysqldump of the Gitea database to w. InnoDB tables are
+// dumped from a consistent snapshot, in a single transaction, without
+// locking them.
+func (m *MySQLAdapter) Dump(w io.Writer, giteaConfig *config.GiteaConfig) error {
 	host, port := parseHostPort(giteaConfig.Database.Host)
 	
 	// Set password environment variable
 	os.Setenv("MYSQL_PWD", giteaConfig.Database.Passwd)
 	defer os.Unsetenv("MYSQL_PWD")
 	
-	outputFile := filepath.Join(settings.BackupTmpFolder, "dump.mysql.sql")
-	
 	args := []string{
 		"--column-statistics=0",
 		"--no-tablespaces",
-		fmt.Sprintf("--host=%s", host),
+		"--single-transaction",
+		"--quick",
+		"--triggers",
 	}
 	
+	if m.Routines {
+		args = append(args, "--routines", "--events")
+	}
+	
+	args = append(args,
+		fmt.Sprintf("--default-character-set=%s", mysqlCharset(giteaConfig)),
+		fmt.Sprintf("--host=%s", host),
+	)
+	
 	if port != "" {
 		args = append(args, fmt.Sprintf("--port=%s", port))
 	}
@@ -39,26 +82,24 @@ func (m *MySQLAdapter) Backup(settings *config.Settings, giteaConfig *config.Git
 	)
 	
 	cmd := exec.Command("mysqldump", args...)
-	
-	// Redirect output to file
-	outFile, err := os.Create(outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer outFile.Close()
-	
-	cmd.Stdout = outFile
+	cmd.Stdout = w
 	
 	logger.Debugf("Running MySQL dump command: mysqldump %s", strings.Join(args, " "))
 	
-	if err := cmd.Run(); err != nil {
+	if err := runClient(cmd); err != nil {
 		return fmt.Errorf("mysqldump failed: %w", err)
 	}
 	
-	logger.Info("MySQL database backup completed")
 	return nil
 }
 
+// CheckDump checks that r holds a complete mysqldump: it starts with the
+// mysqldump banner and ends with its "Dump completed" trailer, which is
+// missing when the dump was interrupted
+func (m *MySQLAdapter) CheckDump(r io.Reader) error {
+	return checkTextDump(r, []string{"-- MySQL dump", "-- MariaDB dump"}, "-- Dump completed")
+}
+
 func (m *MySQLAdapter) Restore(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
 	host, port := parseHostPort(giteaConfig.Database.Host)
 	
@@ -69,6 +110,7 @@ func (m *MySQLAdapter) Restore(settings *config.Settings, giteaConfig *config.Gi
 	inputFile := filepath.Join(settings.RestoreTmpFolder, "dump.mysql.sql")
 	
 	args := []string{
+		fmt.Sprintf("--default-character-set=%s", mysqlCharset(giteaConfig)),
 		fmt.Sprintf("--host=%s", host),
 	}
 	
@@ -94,7 +136,7 @@ func (m *MySQLAdapter) Restore(settings *config.Settings, giteaConfig *config.Gi
 	
 	logger.Debugf("Running MySQL restore command: mysql %s", strings.Join(args, " "))
 	
-	if err := cmd.Run(); err != nil {
+	if err := runClient(cmd); err != nil {
 		return fmt.Errorf("mysql restore failed: %w", err)
 	}
 	
@@ -102,6 +144,14 @@ func (m *MySQLAdapter) Restore(settings *config.Settings, giteaConfig *config.Gi
 	return nil
 }
 
+// mysqlCharset returns the character set of the Gitea database
+func mysqlCharset(giteaConfig *config.GiteaConfig) string {
+	if giteaConfig.Database.Charset != "" {
+		return giteaConfig.Database.Charset
+	}
+	return mysqlDefaultCharset
+}
+
 // parseHostPort splits host:port into separate components
 func parseHostPort(hostPort string) (host, port string) {
 	parts := strings.Split(hostPort, ":")
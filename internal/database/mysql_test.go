@@ -0,0 +1,82 @@
+package database
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+func TestMySQLAdapter_DumpArguments(t *testing.T) {
+	tests := []struct {
+		name     string
+		adapter  *MySQLAdapter
+		charset  string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:     "defaults",
+			adapter:  &MySQLAdapter{},
+			want:     []string{"--single-transaction", "--triggers", "--default-character-set=utf8mb4"},
+			unwanted: []string{"--routines", "--events"},
+		},
+		{
+			name:    "routines and charset",
+			adapter: &MySQLAdapter{Routines: true},
+			charset: "utf8",
+			want:    []string{"--single-transaction", "--routines", "--events", "--default-character-set=utf8"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argsFile := fakeClient(t, "mysqldump", "echo '-- MySQL dump 10.13'")
+			giteaConfig := &config.GiteaConfig{Database: config.DatabaseConfig{
+				DBType:  "mysql",
+				Host:    "db:3306",
+				Name:    "gitea",
+				User:    "gitea",
+				Charset: tt.charset,
+			}}
+
+			var dump strings.Builder
+			if err := tt.adapter.Dump(&dump, giteaConfig); err != nil {
+				t.Fatalf("Dump failed: %v", err)
+			}
+			if !strings.HasPrefix(dump.String(), "-- MySQL dump") {
+				t.Errorf("Expected the mysqldump output, got %q", dump.String())
+			}
+
+			data, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatalf("mysqldump was not run: %v", err)
+			}
+			args := "\n" + string(data)
+			for _, want := range tt.want {
+				if !strings.Contains(args, "\n"+want+"\n") {
+					t.Errorf("Expected mysqldump argument %s, got %q", want, data)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(args, "\n"+unwanted+"\n") {
+					t.Errorf("Unexpected mysqldump argument %s", unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestMySQLAdapter_DumpError(t *testing.T) {
+	fakeClient(t, "mysqldump", `echo "mysqldump: Got error: 1045: Access denied for user 'gitea'@'%'" >&2; exit 2`)
+	giteaConfig := &config.GiteaConfig{Database: config.DatabaseConfig{DBType: "mysql", Host: "db", Name: "gitea", User: "gitea"}}
+
+	err := (&MySQLAdapter{}).Dump(&strings.Builder{}, giteaConfig)
+	if err == nil {
+		t.Fatal("Expected dump to fail, got nil")
+	}
+	if !strings.Contains(err.Error(), "Access denied") {
+		t.Errorf("Expected the mysqldump error in the returned error, got %v", err)
+	}
+}
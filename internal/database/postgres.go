@@ -1,7 +1,10 @@
 package database
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -11,30 +14,35 @@ import (
 	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
 )
 
+// Names of the PostgreSQL dump in the backup archive, by dump format
+const (
+	postgresPlainDump     = "dump.postgres.sql"
+	postgresCustomDump    = "dump.postgres.dump"
+	postgresDirectoryDump = "dump.postgres"
+)
+
+// postgresTOC is the table of contents of a directory format dump
+const postgresTOC = "toc.dat"
+
+// postgresArchiveMagic starts custom format dumps and the table of contents
+// of directory format dumps
+var postgresArchiveMagic = []byte("PGDMP")
+
 // PostgreSQLAdapter implements DatabaseAdapter for PostgreSQL
-type PostgreSQLAdapter struct{}
+type PostgreSQLAdapter struct {
+	// Format is the pg_dump format of new dumps, plain if empty
+	Format string
+	// Jobs is the number of parallel jobs of pg_restore, and of pg_dump in
+	// directory format
+	Jobs int
+}
 
 func (p *PostgreSQLAdapter) Backup(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
-	host, port := parseHostPort(giteaConfig.Database.Host)
-	
-	// Set password environment variable
-	os.Setenv("PGPASSWORD", giteaConfig.Database.Passwd)
-	defer os.Unsetenv("PGPASSWORD")
-	
-	outputFile := filepath.Join(settings.BackupTmpFolder, "dump.postgres.sql")
-	
-	args := []string{
-		fmt.Sprintf("--host=%s", host),
-		fmt.Sprintf("--username=%s", giteaConfig.Database.User),
+	if p.Format == config.PostgresFormatDirectory {
+		return p.dumpDirectory(filepath.Join(settings.BackupTmpFolder, postgresDirectoryDump), giteaConfig)
 	}
 	
-	if port != "" {
-		args = append(args, fmt.Sprintf("--port=%s", port))
-	}
-	
-	args = append(args, giteaConfig.Database.Name)
-	
-	cmd := exec.Command("pg_dump", args...)
+	outputFile := filepath.Join(settings.BackupTmpFolder, p.DumpName())
 	
 	// Redirect output to file
 	outFile, err := os.Create(outputFile)
@@ -43,79 +51,215 @@ func (p *PostgreSQLAdapter) Backup(settings *config.Settings, giteaConfig *confi
 	}
 	defer outFile.Close()
 	
-	cmd.Stdout = outFile
-	
-	logger.Debugf("Running PostgreSQL dump command: pg_dump %s", strings.Join(args, " "))
-	
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("pg_dump failed: %w", err)
+	if err := p.Dump(outFile, giteaConfig); err != nil {
+		return err
 	}
 	
 	logger.Info("PostgreSQL database backup completed")
 	return nil
 }
 
-func (p *PostgreSQLAdapter) Restore(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
-	host, port := parseHostPort(giteaConfig.Database.Host)
+// DumpName returns the name of the dump in the backup archive. Directory
+// format dumps go by their table of contents.
+func (p *PostgreSQLAdapter) DumpName() string {
+	switch p.Format {
+	case config.PostgresFormatCustom:
+		return postgresCustomDump
+	case config.PostgresFormatDirectory:
+		return postgresDirectoryDump + "/" + postgresTOC
+	default:
+		return postgresPlainDump
+	}
+}
+
+// DumpNames returns the name of the dump in the backup archive in every
+// format, so that backups taken before a format change are recognized
+func (p *PostgreSQLAdapter) DumpNames() []string {
+	return []string{postgresPlainDump, postgresCustomDump, postgresDirectoryDump + "/" + postgresTOC}
+}
+
+// CanStream reports whether Dump supports the dump format. Directory format
+// dumps are made of several files.
+func (p *PostgreSQLAdapter) CanStream() bool {
+	return p.Format != config.PostgresFormatDirectory
+}
+
+// Dump writes a plain or custom format pg_dump of the Gitea database to w
+func (p *PostgreSQLAdapter) Dump(w io.Writer, giteaConfig *config.GiteaConfig) error {
+	if !p.CanStream() {
+		return fmt.Errorf("PostgreSQL %s format dumps cannot be streamed", p.Format)
+	}
 	
 	// Set password environment variable
 	os.Setenv("PGPASSWORD", giteaConfig.Database.Passwd)
 	defer os.Unsetenv("PGPASSWORD")
 	
-	inputFile := filepath.Join(settings.RestoreTmpFolder, "dump.postgres.sql")
+	args := postgresConnectionArgs(giteaConfig)
+	if p.Format == config.PostgresFormatCustom {
+		args = append(args, "--format=custom")
+	}
+	args = append(args, giteaConfig.Database.Name)
 	
-	// First, drop existing tables (equivalent to "drop owned by user")
-	dropArgs := []string{
-		fmt.Sprintf("--host=%s", host),
-		fmt.Sprintf("--username=%s", giteaConfig.Database.User),
+	cmd := exec.Command("pg_dump", args...)
+	cmd.Stdout = w
+	
+	logger.Debugf("Running PostgreSQL dump command: pg_dump %s", strings.Join(args, " "))
+	
+	if err := runClient(cmd); err != nil {
+		return fmt.Errorf("pg_dump failed: %w", err)
 	}
 	
-	if port != "" {
-		dropArgs = append(dropArgs, fmt.Sprintf("--port=%s", port))
+	return nil
+}
+
+// dumpDirectory writes a directory format pg_dump of the Gitea database to
+// dir, dumping p.Jobs tables at a time
+func (p *PostgreSQLAdapter) dumpDirectory(dir string, giteaConfig *config.GiteaConfig) error {
+	// pg_dump refuses to write into a directory that is not empty
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove previous dump: %w", err)
 	}
 	
-	dropArgs = append(dropArgs, 
-		"-c", 
-		fmt.Sprintf("DROP OWNED BY %s", giteaConfig.Database.User),
+	// Set password environment variable
+	os.Setenv("PGPASSWORD", giteaConfig.Database.Passwd)
+	defer os.Unsetenv("PGPASSWORD")
+	
+	args := append(postgresConnectionArgs(giteaConfig),
+		"--format=directory",
+		fmt.Sprintf("--jobs=%d", max(p.Jobs, 1)),
+		fmt.Sprintf("--file=%s", dir),
 		giteaConfig.Database.Name,
 	)
 	
-	dropCmd := exec.Command("psql", dropArgs...)
+	cmd := exec.Command("pg_dump", args...)
 	
-	logger.Debugf("Running PostgreSQL drop command: psql %s", strings.Join(dropArgs, " "))
+	logger.Debugf("Running PostgreSQL dump command: pg_dump %s", strings.Join(args, " "))
 	
-	// Drop command might fail if there are no existing tables, so we don't check error
-	dropCmd.Run()
+	if err := runClient(cmd); err != nil {
+		return fmt.Errorf("pg_dump failed: %w", err)
+	}
 	
-	// Now restore from backup
-	restoreArgs := []string{
-		fmt.Sprintf("--host=%s", host),
-		fmt.Sprintf("--username=%s", giteaConfig.Database.User),
+	logger.Info("PostgreSQL database backup completed")
+	return nil
+}
+
+// CheckDump checks that r holds a usable pg_dump. A plain dump must start
+// with the pg_dump banner and end with its "dump complete" trailer, which is
+// missing when the dump was interrupted. A custom format dump, or the table
+// of contents of a directory format dump, must start with the pg_dump archive
+// header.
+func (p *PostgreSQLAdapter) CheckDump(r io.Reader) error {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(len(postgresArchiveMagic)); bytes.Equal(head, postgresArchiveMagic) {
+		_, err := io.Copy(io.Discard, br)
+		return err
+	}
+	return checkTextDump(br, []string{"-- PostgreSQL database dump"}, "-- PostgreSQL database dump complete")
+}
+
+// Restore restores the dump found in RestoreTmpFolder, whatever the dump
+// format of the settings: custom and directory format dumps with pg_restore,
+// plain dumps with psql. The folder must hold a single dump.
+func (p *PostgreSQLAdapter) Restore(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
+	var found []string
+	for _, name := range p.DumpNames() {
+		if _, err := os.Stat(filepath.Join(settings.RestoreTmpFolder, filepath.FromSlash(name))); err == nil {
+			found = append(found, name)
+		}
+	}
+	switch {
+	case len(found) == 0:
+		return fmt.Errorf("no PostgreSQL dump found in %s", settings.RestoreTmpFolder)
+	case len(found) > 1:
+		return fmt.Errorf("several PostgreSQL dumps found in %s, cannot tell which one to restore: %s", settings.RestoreTmpFolder, strings.Join(found, ", "))
 	}
 	
-	if port != "" {
-		restoreArgs = append(restoreArgs, fmt.Sprintf("--port=%s", port))
+	switch found[0] {
+	case postgresDirectoryDump + "/" + postgresTOC:
+		return p.pgRestore(filepath.Join(settings.RestoreTmpFolder, postgresDirectoryDump), giteaConfig)
+	case postgresCustomDump:
+		return p.pgRestore(filepath.Join(settings.RestoreTmpFolder, postgresCustomDump), giteaConfig)
 	}
 	
-	restoreArgs = append(restoreArgs, giteaConfig.Database.Name)
+	// Set password environment variable
+	os.Setenv("PGPASSWORD", giteaConfig.Database.Passwd)
+	defer os.Unsetenv("PGPASSWORD")
 	
-	restoreCmd := exec.Command("psql", restoreArgs...)
+	inputFile := filepath.Join(settings.RestoreTmpFolder, postgresPlainDump)
 	
-	// Read input from file
-	inFile, err := os.Open(inputFile)
-	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+	// Drop the objects of the Gitea user and replay the dump in a single
+	// transaction that stops at the first error, so that a failed restore
+	// leaves the database as it was
+	args := append(postgresConnectionArgs(giteaConfig),
+		"--no-psqlrc",
+		"--quiet",
+		"--single-transaction",
+		"--set=ON_ERROR_STOP=1",
+		fmt.Sprintf("--command=DROP OWNED BY %s", postgresQuoteIdent(giteaConfig.Database.User)),
+		fmt.Sprintf("--file=%s", inputFile),
+		fmt.Sprintf("--dbname=%s", giteaConfig.Database.Name),
+	)
+	
+	cmd := exec.Command("psql", args...)
+	
+	logger.Debugf("Running PostgreSQL restore command: psql %s", strings.Join(args, " "))
+	
+	if err := runClient(cmd); err != nil {
+		return fmt.Errorf("psql restore failed, the database was left unchanged: %w", err)
 	}
-	defer inFile.Close()
 	
-	restoreCmd.Stdin = inFile
+	logger.Info("PostgreSQL database restore completed")
+	return nil
+}
+
+// pgRestore restores the custom or directory format dump at path with
+// pg_restore, running p.Jobs jobs in parallel. Existing objects of the dump
+// are dropped first, and the restore stops at the first error: pg_restore
+// otherwise goes on and exits non-zero over a partially restored database.
+func (p *PostgreSQLAdapter) pgRestore(path string, giteaConfig *config.GiteaConfig) error {
+	// Set password environment variable
+	os.Setenv("PGPASSWORD", giteaConfig.Database.Passwd)
+	defer os.Unsetenv("PGPASSWORD")
 	
-	logger.Debugf("Running PostgreSQL restore command: psql %s", strings.Join(restoreArgs, " "))
+	args := append(postgresConnectionArgs(giteaConfig),
+		fmt.Sprintf("--dbname=%s", giteaConfig.Database.Name),
+		"--clean",
+		"--if-exists",
+		"--exit-on-error",
+		fmt.Sprintf("--jobs=%d", max(p.Jobs, 1)),
+		path,
+	)
+	
+	cmd := exec.Command("pg_restore", args...)
+	
+	logger.Debugf("Running PostgreSQL restore command: pg_restore %s", strings.Join(args, " "))
 	
-	if err := restoreCmd.Run(); err != nil {
-		return fmt.Errorf("psql restore failed: %w", err)
+	if err := runClient(cmd); err != nil {
+		return fmt.Errorf("pg_restore failed: %w", err)
 	}
 	
 	logger.Info("PostgreSQL database restore completed")
 	return nil
+}
+
+// postgresConnectionArgs returns the host, user and port arguments of the
+// PostgreSQL client tools
+func postgresConnectionArgs(giteaConfig *config.GiteaConfig) []string {
+	host, port := parseHostPort(giteaConfig.Database.Host)
+	
+	args := []string{
+		fmt.Sprintf("--host=%s", host),
+		fmt.Sprintf("--username=%s", giteaConfig.Database.User),
+	}
+	
+	if port != "" {
+		args = append(args, fmt.Sprintf("--port=%s", port))
+	}
+	
+	return args
+}
+
+// postgresQuoteIdent returns s as an SQL identifier
+func postgresQuoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
 }
\ No newline at end of file
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+// fakeClient installs a shell script named name first in PATH. The script
+// appends its arguments, one per line, to the returned file, ends each run
+// with an empty line, and runs body.
+func fakeClient(t *testing.T, name, body string) string {
+	t.Helper()
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, name+".args")
+	script := "#!/bin/sh\n{ printf '%s\\n' \"$@\"; echo; } >> " + argsFile + "\n" + body + "\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create fake %s: %v", name, err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return argsFile
+}
+
+func newPlainRestore(t *testing.T) (*config.Settings, *config.GiteaConfig) {
+	t.Helper()
+	restoreDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(restoreDir, "dump.postgres.sql"), []byte("CREATE TABLE t ();\n"), 0644); err != nil {
+		t.Fatalf("Failed to create dump: %v", err)
+	}
+	settings := &config.Settings{RestoreTmpFolder: restoreDir}
+	giteaConfig := &config.GiteaConfig{Database: config.DatabaseConfig{
+		DBType: "postgres",
+		Host:   "db:5432",
+		Name:   "gitea",
+		User:   "gitea",
+	}}
+	return settings, giteaConfig
+}
+
+func TestPostgreSQLAdapter_RestoreSingleTransaction(t *testing.T) {
+	argsFile := fakeClient(t, "psql", "exit 0")
+	settings, giteaConfig := newPlainRestore(t)
+
+	if err := (&PostgreSQLAdapter{}).Restore(settings, giteaConfig); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("psql was not run: %v", err)
+	}
+	args := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for _, want := range []string{
+		"--single-transaction",
+		"--set=ON_ERROR_STOP=1",
+		`--command=DROP OWNED BY "gitea"`,
+		"--file=" + filepath.Join(settings.RestoreTmpFolder, "dump.postgres.sql"),
+		"--dbname=gitea",
+	} {
+		found := false
+		for _, arg := range args {
+			if arg == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Expected psql argument %s, got %v", want, args)
+		}
+	}
+}
+
+func TestPostgreSQLAdapter_RestoreError(t *testing.T) {
+	fakeClient(t, "psql", `echo 'psql:dump.postgres.sql:1: ERROR:  relation "t" already exists' >&2; exit 3`)
+	settings, giteaConfig := newPlainRestore(t)
+
+	err := (&PostgreSQLAdapter{}).Restore(settings, giteaConfig)
+	if err == nil {
+		t.Fatal("Expected restore to fail, got nil")
+	}
+	if !strings.Contains(err.Error(), `relation "t" already exists`) {
+		t.Errorf("Expected the psql error in the returned error, got %v", err)
+	}
+}
+
+func TestPostgreSQLAdapter_RestoreSeveralDumps(t *testing.T) {
+	argsFile := fakeClient(t, "pg_restore", "exit 0")
+	fakeClient(t, "psql", "exit 0")
+	settings, giteaConfig := newPlainRestore(t)
+
+	// A custom format dump left over from another backup
+	if err := os.WriteFile(filepath.Join(settings.RestoreTmpFolder, "dump.postgres.dump"), []byte("PGDMP"), 0644); err != nil {
+		t.Fatalf("Failed to create dump: %v", err)
+	}
+
+	err := (&PostgreSQLAdapter{}).Restore(settings, giteaConfig)
+	if err == nil || !strings.Contains(err.Error(), "several PostgreSQL dumps") {
+		t.Errorf("Expected an error for several dumps, got %v", err)
+	}
+	if _, err := os.Stat(argsFile); !os.IsNotExist(err) {
+		t.Error("Expected pg_restore not to be run")
+	}
+}
+
+func TestPostgreSQLAdapter_RestoreCustomFormat(t *testing.T) {
+	argsFile := fakeClient(t, "pg_restore", "exit 0")
+	settings, giteaConfig := newPlainRestore(t)
+
+	dump := filepath.Join(settings.RestoreTmpFolder, "dump.postgres.dump")
+	if err := os.Rename(filepath.Join(settings.RestoreTmpFolder, "dump.postgres.sql"), dump); err != nil {
+		t.Fatalf("Failed to create dump: %v", err)
+	}
+
+	if err := (&PostgreSQLAdapter{Jobs: 4}).Restore(settings, giteaConfig); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("pg_restore was not run: %v", err)
+	}
+	args := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for _, want := range []string{"--clean", "--if-exists", "--exit-on-error", "--jobs=4", "--dbname=gitea", dump} {
+		found := false
+		for _, arg := range args {
+			if arg == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Expected pg_restore argument %s, got %v", want, args)
+		}
+	}
+}
+
+func TestPostgresQuoteIdent(t *testing.T) {
+	if got := postgresQuoteIdent(`git"ea`); got != `"git""ea"` {
+		t.Errorf("Unexpected quoting: %s", got)
+	}
+}
@@ -1,39 +1,161 @@
 package database
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/Frantche/gitea-backup-restore-process/internal/config"
 	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
 )
 
+// sqliteMagic starts every SQLite database file, followed by the rest of its
+// 100 bytes header
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+const sqliteHeaderSize = 100
+
+// sqliteBusyTimeout is how long a snapshot waits for Gitea to release a lock
+const sqliteBusyTimeout = 30 * time.Second
+
+// sqliteFileSuffixes are the suffixes of the database file and of the
+// journal files SQLite keeps next to it
+var sqliteFileSuffixes = []string{"", "-wal", "-shm", "-journal"}
+
 // SQLiteAdapter implements DatabaseAdapter for SQLite
 type SQLiteAdapter struct{}
 
 func (s *SQLiteAdapter) Backup(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
-	// For SQLite, we simply copy the database file
 	sourcePath := giteaConfig.Database.Path
 	if sourcePath == "" {
 		return fmt.Errorf("SQLite database path not configured")
 	}
 	
-	// Check if source file exists
-	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
-		return fmt.Errorf("SQLite database file does not exist: %s", sourcePath)
+	outputFile := filepath.Join(settings.BackupTmpFolder, s.DumpName())
+	
+	// VACUUM INTO refuses to overwrite an existing file
+	if err := os.Remove(outputFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove previous SQLite backup: %w", err)
 	}
 	
-	outputFile := filepath.Join(settings.BackupTmpFolder, "dump.sqlite3.db")
+	if err := snapshotSQLite(sourcePath, outputFile); err != nil {
+		return err
+	}
 	
-	logger.Debugf("Copying SQLite database from %s to %s", sourcePath, outputFile)
+	logger.Info("SQLite database backup completed")
+	return nil
+}
+
+// DumpName returns the name of the dump in the backup archive
+func (s *SQLiteAdapter) DumpName() string {
+	return "dump.sqlite3.db"
+}
+
+// Dump writes a consistent snapshot of the SQLite database to w. The
+// snapshot is taken to a temporary file first, SQLite cannot write it to a
+// stream.
+func (s *SQLiteAdapter) Dump(w io.Writer, giteaConfig *config.GiteaConfig) error {
+	sourcePath := giteaConfig.Database.Path
+	if sourcePath == "" {
+		return fmt.Errorf("SQLite database path not configured")
+	}
 	
-	if err := copyFile(sourcePath, outputFile); err != nil {
-		return fmt.Errorf("failed to copy SQLite database: %w", err)
+	tmpDir, err := os.MkdirTemp("", "gitea-sqlite-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	
+	snapshotPath := filepath.Join(tmpDir, s.DumpName())
+	if err := snapshotSQLite(sourcePath, snapshotPath); err != nil {
+		return err
+	}
+	
+	snapshot, err := os.Open(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite snapshot: %w", err)
+	}
+	defer snapshot.Close()
+	
+	logger.Debugf("Streaming SQLite snapshot of %s", sourcePath)
+	
+	if _, err := io.Copy(w, snapshot); err != nil {
+		return fmt.Errorf("failed to copy SQLite snapshot: %w", err)
 	}
 	
-	logger.Info("SQLite database backup completed")
+	return nil
+}
+
+// snapshotSQLite writes a consistent copy of the database at src to the new
+// file dst with VACUUM INTO. Unlike a file copy, it reads the database
+// through SQLite in a single read transaction, write-ahead log included, so
+// Gitea can keep writing meanwhile.
+func snapshotSQLite(src, dst string) error {
+	// sqlite3 would create an empty database
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("SQLite database file does not exist: %s", src)
+	}
+	
+	args := []string{
+		"-bail",
+		"-cmd", fmt.Sprintf(".timeout %d", sqliteBusyTimeout.Milliseconds()),
+		src,
+		fmt.Sprintf("VACUUM INTO %s;", sqliteQuote(dst)),
+	}
+	
+	cmd := exec.Command("sqlite3", args...)
+	
+	logger.Debugf("Running SQLite snapshot command: sqlite3 %s", strings.Join(args, " "))
+	
+	if err := runClient(cmd); err != nil {
+		return fmt.Errorf("sqlite3 snapshot failed: %w", err)
+	}
+	
+	return nil
+}
+
+// sqliteQuote returns s as an SQL string literal
+func sqliteQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// CheckDump checks that r holds an SQLite database: it starts with the
+// SQLite header and its size is a whole number of pages
+func (s *SQLiteAdapter) CheckDump(r io.Reader) error {
+	header := make([]byte, sqliteHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("not an SQLite database: only %d bytes", n)
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(header, sqliteMagic) {
+		return fmt.Errorf("not an SQLite database: missing SQLite header")
+	}
+	
+	// The page size is stored big-endian at offset 16, 1 means 65536
+	pageSize := int64(binary.BigEndian.Uint16(header[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("invalid SQLite page size %d", pageSize)
+	}
+	
+	rest, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return err
+	}
+	if size := int64(n) + rest; size%pageSize != 0 {
+		return fmt.Errorf("SQLite database is truncated: %d bytes is not a multiple of the %d bytes page size", size, pageSize)
+	}
 	return nil
 }
 
@@ -59,45 +181,68 @@ func (s *SQLiteAdapter) Restore(settings *config.Settings, giteaConfig *config.G
 		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 	
-	// Remove existing database file if it exists
-	if _, err := os.Stat(targetPath); err == nil {
-		if err := os.Remove(targetPath); err != nil {
-			return fmt.Errorf("failed to remove existing database file: %w", err)
-		}
+	// The live database is only replaced once the copy is complete
+	if err := replaceFile(inputFile, targetPath); err != nil {
+		return fmt.Errorf("failed to restore SQLite database: %w", err)
 	}
 	
-	if err := copyFile(inputFile, targetPath); err != nil {
-		return fmt.Errorf("failed to restore SQLite database: %w", err)
+	// Remove the journal files of the previous database, so that SQLite does
+	// not replay stale write-ahead log frames into the restored one
+	for _, suffix := range sqliteFileSuffixes[1:] {
+		if err := os.Remove(targetPath + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale journal file: %w", err)
+		}
 	}
 	
 	logger.Info("SQLite database restore completed")
 	return nil
 }
 
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
+// replaceFile copies src to a temporary file next to dst, flushes it to
+// disk and renames it over dst, so that dst is either left as it was or
+// fully replaced
+func replaceFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer sourceFile.Close()
 	
-	destFile, err := os.Create(dst)
+	sourceInfo, err := sourceFile.Stat()
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
 	
-	_, err = io.Copy(destFile, sourceFile)
+	tmpFile, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".restore-*")
 	if err != nil {
 		return err
 	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+	defer tmpFile.Close()
 	
-	// Copy file permissions
-	sourceInfo, err := os.Stat(src)
-	if err != nil {
+	if _, err := io.Copy(tmpFile, sourceFile); err != nil {
+		return err
+	}
+	if err := tmpFile.Chmod(sourceInfo.Mode()); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	
+	if err := os.Rename(tmpPath, dst); err != nil {
 		return err
 	}
 	
-	return os.Chmod(dst, sourceInfo.Mode())
-}
\ No newline at end of file
+	// Make the rename itself durable
+	dir, err := os.Open(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
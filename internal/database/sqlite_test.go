@@ -0,0 +1,188 @@
+package database
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+func requireSQLite(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+}
+
+func sqliteQuery(t *testing.T, path, query string) string {
+	t.Helper()
+	out, err := exec.Command("sqlite3", path, query).CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 %s failed: %v: %s", query, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// openWALWriter creates a WAL database at path holding rows that are only in
+// its write-ahead log, as while Gitea is running, until the test ends
+func openWALWriter(t *testing.T, path string) {
+	t.Helper()
+	cmd := exec.Command("sqlite3", path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("Failed to open sqlite3 stdin: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start sqlite3: %v", err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+
+	io.WriteString(stdin, "PRAGMA journal_mode=WAL;\nPRAGMA wal_autocheckpoint=0;\n"+
+		"CREATE TABLE repository (name TEXT);\n"+
+		"INSERT INTO repository VALUES ('gitea'), ('tea');\n")
+
+	// Wait for the rows to reach the write-ahead log
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if info, err := os.Stat(path + "-wal"); err == nil && info.Size() > 0 && sqliteQuery(t, path, "SELECT count(*) FROM repository") == "2" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the write-ahead log")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSQLiteAdapter_BackupWAL(t *testing.T) {
+	requireSQLite(t)
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "gitea.db")
+	openWALWriter(t, dbPath)
+
+	settings := &config.Settings{BackupTmpFolder: tmpDir}
+	giteaConfig := &config.GiteaConfig{Database: config.DatabaseConfig{DBType: "sqlite3", Path: dbPath}}
+	adapter := &SQLiteAdapter{}
+
+	if err := adapter.Backup(settings, giteaConfig); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	backupPath := filepath.Join(tmpDir, adapter.DumpName())
+	if got := sqliteQuery(t, backupPath, "SELECT count(*) FROM repository"); got != "2" {
+		t.Errorf("Expected the rows of the write-ahead log in the backup, got %s", got)
+	}
+
+	// A second backup replaces the first one
+	if err := adapter.Backup(settings, giteaConfig); err != nil {
+		t.Fatalf("Second backup failed: %v", err)
+	}
+
+	var dump bytes.Buffer
+	if err := adapter.Dump(&dump, giteaConfig); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if err := adapter.CheckDump(bytes.NewReader(dump.Bytes())); err != nil {
+		t.Errorf("Expected a valid dump, got %v", err)
+	}
+}
+
+func TestSQLiteAdapter_BackupMissingDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+	settings := &config.Settings{BackupTmpFolder: tmpDir}
+	giteaConfig := &config.GiteaConfig{Database: config.DatabaseConfig{DBType: "sqlite3", Path: filepath.Join(tmpDir, "missing.db")}}
+
+	if err := (&SQLiteAdapter{}).Backup(settings, giteaConfig); err == nil {
+		t.Error("Expected error for a missing database, got nil")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "missing.db")); !os.IsNotExist(err) {
+		t.Error("Expected the missing database not to be created")
+	}
+}
+
+func TestSQLiteAdapter_RestoreRemovesJournals(t *testing.T) {
+	requireSQLite(t)
+	tmpDir := t.TempDir()
+	restoreDir := filepath.Join(tmpDir, "restore")
+	if err := os.MkdirAll(restoreDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	adapter := &SQLiteAdapter{}
+	sqliteQuery(t, filepath.Join(restoreDir, adapter.DumpName()), "CREATE TABLE repository (name TEXT); INSERT INTO repository VALUES ('restored');")
+
+	dbPath := filepath.Join(tmpDir, "data", "gitea.db")
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.WriteFile(dbPath+suffix, []byte("stale"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	settings := &config.Settings{RestoreTmpFolder: restoreDir}
+	giteaConfig := &config.GiteaConfig{Database: config.DatabaseConfig{DBType: "sqlite3", Path: dbPath}}
+	if err := adapter.Restore(settings, giteaConfig); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(dbPath + suffix); !os.IsNotExist(err) {
+			t.Errorf("Expected stale %s file to be removed", suffix)
+		}
+	}
+	if got := sqliteQuery(t, dbPath, "SELECT name FROM repository"); got != "restored" {
+		t.Errorf("Expected the restored database, got %q", got)
+	}
+}
+
+func TestSQLiteAdapter_RestoreFailedCopyKeepsDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+	restoreDir := filepath.Join(tmpDir, "restore")
+	adapter := &SQLiteAdapter{}
+	// A dump that cannot be read makes the copy fail
+	if err := os.MkdirAll(filepath.Join(restoreDir, adapter.DumpName()), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	dataDir := filepath.Join(tmpDir, "data")
+	dbPath := filepath.Join(dataDir, "gitea.db")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, suffix := range []string{"", "-wal"} {
+		if err := os.WriteFile(dbPath+suffix, []byte("live"+suffix), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	settings := &config.Settings{RestoreTmpFolder: restoreDir}
+	giteaConfig := &config.GiteaConfig{Database: config.DatabaseConfig{DBType: "sqlite3", Path: dbPath}}
+	if err := adapter.Restore(settings, giteaConfig); err == nil {
+		t.Fatal("Expected restore to fail, got nil")
+	}
+
+	for _, suffix := range []string{"", "-wal"} {
+		if data, err := os.ReadFile(dbPath + suffix); err != nil || string(data) != "live"+suffix {
+			t.Errorf("Expected gitea.db%s to be left as it was, got %q, %v", suffix, data, err)
+		}
+	}
+	entries, err := os.ReadDir(dataDir)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Expected no temporary file to be left behind, got %v", entries)
+	}
+}
+
+func TestSQLiteQuote(t *testing.T) {
+	if got := sqliteQuote("/tmp/o'brien.db"); got != "'/tmp/o''brien.db'" {
+		t.Errorf("Unexpected quoting: %s", got)
+	}
+}
@@ -0,0 +1,211 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+// ErrWrongKey is returned when an encrypted archive cannot be decrypted with
+// the configured identity or passphrase
+var ErrWrongKey = errors.New("wrong decryption key: the archive was encrypted for a different identity or passphrase")
+
+// ErrNoKey is returned when an archive is encrypted but no identity or
+// passphrase is configured
+var ErrNoKey = errors.New("archive is encrypted but no decryption key is configured")
+
+// ageMagic starts every age encrypted file
+var ageMagic = []byte("age-encryption.org/")
+
+// Enabled reports whether new backups are encrypted
+func Enabled(settings *config.Settings) bool {
+	return len(settings.EncryptionRecipients) > 0 || settings.EncryptionPassphrase != ""
+}
+
+// NewWriter returns a writer encrypting to w with the configured age
+// recipients or passphrase. Close must be called to flush the last block; it
+// does not close w.
+func NewWriter(w io.Writer, settings *config.Settings) (io.WriteCloser, error) {
+	if len(settings.EncryptionRecipients) > 0 {
+		recipients, err := parseRecipients(settings.EncryptionRecipients)
+		if err != nil {
+			return nil, err
+		}
+		return age.Encrypt(w, recipients...)
+	}
+	if settings.EncryptionPassphrase != "" {
+		return newPassphraseWriter(w, settings.EncryptionPassphrase)
+	}
+	return nil, fmt.Errorf("encryption is not configured")
+}
+
+// NewReader returns a reader decrypting r. Archives that are not encrypted
+// are returned unchanged, so restores work with both.
+func NewReader(r io.Reader, settings *config.Settings) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(ageMagic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read archive header: %w", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(header, ageMagic):
+		if settings.EncryptionIdentityFile == "" {
+			return nil, ErrNoKey
+		}
+		identities, err := readIdentities(settings.EncryptionIdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		decrypted, err := age.Decrypt(br, identities...)
+		if err != nil {
+			var noMatch *age.NoIdentityMatchError
+			if errors.As(err, &noMatch) {
+				return nil, ErrWrongKey
+			}
+			return nil, fmt.Errorf("failed to decrypt archive: %w", err)
+		}
+		return decrypted, nil
+	case bytes.HasPrefix(header, passphraseMagic):
+		if settings.EncryptionPassphrase == "" {
+			return nil, ErrNoKey
+		}
+		return newPassphraseReader(br, settings.EncryptionPassphrase)
+	default:
+		return br, nil
+	}
+}
+
+// EncryptFile encrypts the backup tmp file in place
+func EncryptFile(settings *config.Settings) error {
+	logger.Info("Encrypting backup archive")
+
+	if err := rewriteFile(settings.BackupTmpFilename, func(dst io.Writer, src io.Reader) error {
+		encrypted, err := NewWriter(dst, settings)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(encrypted, src); err != nil {
+			return err
+		}
+		return encrypted.Close()
+	}); err != nil {
+		return fmt.Errorf("failed to encrypt archive: %w", err)
+	}
+
+	logger.Info("Backup archive encrypted successfully")
+	return nil
+}
+
+// DecryptFile decrypts the restore tmp file in place. Unencrypted archives
+// are left untouched.
+func DecryptFile(settings *config.Settings) error {
+	encrypted, err := isEncrypted(settings.RestoreTmpFilename)
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		logger.Debug("Backup archive is not encrypted")
+		return nil
+	}
+
+	logger.Info("Decrypting backup archive")
+
+	if err := rewriteFile(settings.RestoreTmpFilename, func(dst io.Writer, src io.Reader) error {
+		decrypted, err := NewReader(src, settings)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, decrypted)
+		return err
+	}); err != nil {
+		if errors.Is(err, ErrWrongKey) || errors.Is(err, ErrNoKey) {
+			return err
+		}
+		return fmt.Errorf("failed to decrypt archive: %w", err)
+	}
+
+	logger.Info("Backup archive decrypted successfully")
+	return nil
+}
+
+// isEncrypted reports whether the file at path starts with a known
+// encryption header
+func isEncrypted(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, len(ageMagic))
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, fmt.Errorf("failed to read archive header: %w", err)
+	}
+	header = header[:n]
+	return bytes.HasPrefix(header, ageMagic) || bytes.HasPrefix(header, passphraseMagic), nil
+}
+
+// rewriteFile replaces the file at path with the output of transform, going
+// through a temporary file in the same folder
+func rewriteFile(path string, transform func(dst io.Writer, src io.Reader) error) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+
+	if err := transform(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Rename(dst.Name(), path)
+}
+
+// parseRecipients parses age X25519 public keys ("age1...")
+func parseRecipients(values []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, value := range values {
+		recipient, err := age.ParseX25519Recipient(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", value, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// readIdentities reads age identities ("AGE-SECRET-KEY-1...") from an identity file
+func readIdentities(path string) ([]age.Identity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %w", err)
+	}
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file %s: %w", path, err)
+	}
+	return identities, nil
+}
@@ -0,0 +1,163 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+func encrypt(t *testing.T, settings *config.Settings, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, settings)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(settings *config.Settings, encrypted []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(encrypted), settings)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestPassphrase_RoundTrip(t *testing.T) {
+	settings := &config.Settings{EncryptionPassphrase: "correct horse battery staple"}
+
+	for _, size := range []int{0, 1, chunkSize, chunkSize + 1, 3*chunkSize - 7} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		encrypted := encrypt(t, settings, plain)
+		// Shorter plaintexts can show up in the ciphertext by chance
+		if size >= 16 && bytes.Contains(encrypted, plain[:min(size, 64)]) {
+			t.Errorf("Size %d: encrypted data contains plaintext", size)
+		}
+
+		decrypted, err := decrypt(settings, encrypted)
+		if err != nil {
+			t.Fatalf("Size %d: decrypt failed: %v", size, err)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			t.Errorf("Size %d: decrypted data differs from plaintext", size)
+		}
+	}
+}
+
+func TestPassphrase_WrongKey(t *testing.T) {
+	encrypted := encrypt(t, &config.Settings{EncryptionPassphrase: "right"}, []byte("secret"))
+
+	_, err := decrypt(&config.Settings{EncryptionPassphrase: "wrong"}, encrypted)
+	if !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey, got %v", err)
+	}
+
+	_, err = decrypt(&config.Settings{}, encrypted)
+	if !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey, got %v", err)
+	}
+}
+
+func TestPassphrase_Truncated(t *testing.T) {
+	settings := &config.Settings{EncryptionPassphrase: "passphrase"}
+	plain := make([]byte, 2*chunkSize+100)
+	encrypted := encrypt(t, settings, plain)
+
+	// Drop the final chunk: the remaining data ends on a chunk boundary
+	truncated := encrypted[:len(encrypted)-(100+16)]
+	if _, err := decrypt(settings, truncated); err == nil {
+		t.Error("Expected error for truncated archive, got nil")
+	}
+}
+
+func TestAge_RoundTrip(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Failed to generate identity: %v", err)
+	}
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write identity file: %v", err)
+	}
+
+	settings := &config.Settings{
+		EncryptionRecipients:   []string{identity.Recipient().String()},
+		EncryptionIdentityFile: identityFile,
+	}
+
+	encrypted := encrypt(t, settings, []byte("archive content"))
+	decrypted, err := decrypt(settings, encrypted)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if string(decrypted) != "archive content" {
+		t.Errorf("Unexpected decrypted content: %q", decrypted)
+	}
+
+	// Another identity cannot decrypt the archive
+	other, _ := age.GenerateX25519Identity()
+	otherFile := filepath.Join(t.TempDir(), "other.txt")
+	if err := os.WriteFile(otherFile, []byte(other.String()+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write identity file: %v", err)
+	}
+	_, err = decrypt(&config.Settings{EncryptionIdentityFile: otherFile}, encrypted)
+	if !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey, got %v", err)
+	}
+}
+
+func TestNewWriter_InvalidRecipient(t *testing.T) {
+	settings := &config.Settings{EncryptionRecipients: []string{"age1notakey"}}
+	if _, err := NewWriter(io.Discard, settings); err == nil {
+		t.Error("Expected error for invalid recipient, got nil")
+	}
+}
+
+func TestEncryptDecryptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	if err := os.WriteFile(path, []byte("PK\x03\x04 zip content"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	settings := &config.Settings{
+		EncryptionPassphrase: "passphrase",
+		BackupTmpFilename:    path,
+		RestoreTmpFilename:   path,
+	}
+
+	if err := EncryptFile(settings); err != nil {
+		t.Fatalf("EncryptFile failed: %v", err)
+	}
+	if encrypted, _ := isEncrypted(path); !encrypted {
+		t.Fatal("Expected file to be encrypted")
+	}
+
+	if err := DecryptFile(settings); err != nil {
+		t.Fatalf("DecryptFile failed: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "PK\x03\x04 zip content" {
+		t.Errorf("Unexpected decrypted content: %q", content)
+	}
+
+	// Plain archives are left untouched
+	if err := DecryptFile(&config.Settings{RestoreTmpFilename: path}); err != nil {
+		t.Errorf("DecryptFile failed on a plain archive: %v", err)
+	}
+}
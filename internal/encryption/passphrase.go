@@ -0,0 +1,203 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Passphrase encrypted archives are a header followed by AES-256-GCM sealed
+// chunks of chunkSize bytes (the last one may be shorter):
+//
+//	magic | scrypt log2(N) (1 byte) | salt (16 bytes) | key check (32 bytes) | chunks...
+//
+// The key is derived with scrypt from the passphrase and a random salt, so
+// every archive has its own key and chunk nonces can be a plain counter. The
+// last byte of the nonce flags the final chunk, which detects truncation.
+// The key check is a hash of a second derived key, used to tell a wrong
+// passphrase from a corrupted archive.
+var passphraseMagic = []byte("gitea-br-enc/v1\n")
+
+const (
+	chunkSize   = 64 << 10
+	saltSize    = 16
+	keyCheckLen = sha256.Size
+	scryptLogN  = 15
+	scryptR     = 8
+	scryptP     = 1
+	// Refuse to spend more than a few seconds and 1 GiB deriving a key
+	maxScryptLogN = 20
+)
+
+// deriveKey returns the AES key and the key check for passphrase and salt
+func deriveKey(passphrase string, salt []byte, logN byte) (key, check []byte, err error) {
+	derived, err := scrypt.Key([]byte(passphrase), salt, 1<<logN, scryptR, scryptP, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(derived[32:])
+	return derived[:32], sum[:], nil
+}
+
+func chunkNonce(counter uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type passphraseWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+}
+
+func newPassphraseWriter(w io.Writer, passphrase string) (*passphraseWriter, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, check, err := deriveKey(passphrase, salt, scryptLogN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(append(append(append([]byte{}, passphraseMagic...), scryptLogN), salt...), check...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &passphraseWriter{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (p *passphraseWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		// Only seal a full chunk once more data shows up: the final chunk
+		// must be sealed as such by Close
+		if len(p.buf) == chunkSize {
+			if err := p.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(p.buf[len(p.buf):chunkSize], data)
+		p.buf = p.buf[:len(p.buf)+n]
+		data = data[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (p *passphraseWriter) flush(final bool) error {
+	sealed := p.aead.Seal(nil, chunkNonce(p.counter, final), p.buf, nil)
+	p.counter++
+	p.buf = p.buf[:0]
+	_, err := p.w.Write(sealed)
+	return err
+}
+
+// Close seals the final chunk. It does not close the underlying writer.
+func (p *passphraseWriter) Close() error {
+	return p.flush(true)
+}
+
+type passphraseReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	chunk   []byte
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+func newPassphraseReader(r *bufio.Reader, passphrase string) (*passphraseReader, error) {
+	header := make([]byte, len(passphraseMagic)+1+saltSize+keyCheckLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	logN := header[len(passphraseMagic)]
+	salt := header[len(passphraseMagic)+1 : len(passphraseMagic)+1+saltSize]
+	expectedCheck := header[len(passphraseMagic)+1+saltSize:]
+
+	if logN > maxScryptLogN {
+		return nil, fmt.Errorf("unsupported scrypt work factor 2^%d", logN)
+	}
+
+	key, check, err := deriveKey(passphrase, salt, logN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	if subtle.ConstantTimeCompare(check, expectedCheck) != 1 {
+		return nil, ErrWrongKey
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &passphraseReader{r: r, aead: aead, chunk: make([]byte, chunkSize+aead.Overhead())}, nil
+}
+
+func (p *passphraseReader) Read(out []byte) (int, error) {
+	for len(p.plain) == 0 {
+		if p.done {
+			return 0, io.EOF
+		}
+		if err := p.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(out, p.plain)
+	p.plain = p.plain[n:]
+	return n, nil
+}
+
+// next reads and opens the next chunk
+func (p *passphraseReader) next() error {
+	n, err := io.ReadFull(p.r, p.chunk)
+	final := false
+	switch {
+	case err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF):
+		final = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the final one if nothing follows
+		if _, peekErr := p.r.Peek(1); peekErr == io.EOF {
+			final = true
+		}
+	}
+
+	plain, err := p.aead.Open(p.chunk[:0], chunkNonce(p.counter, final), p.chunk[:n], nil)
+	if err != nil {
+		return fmt.Errorf("archive is corrupted or truncated (chunk %d)", p.counter)
+	}
+	p.counter++
+	p.plain = plain
+	p.done = final
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
 	"github.com/Frantche/gitea-backup-restore-process/internal/config"
 	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
 )
@@ -79,6 +80,43 @@ func BackupFiles(settings *config.Settings, giteaConfig *config.GiteaConfig) err
 	return nil
 }
 
+// StreamFiles writes Gitea files (repositories, avatars, etc.) straight into
+// archive, with the same layout as BackupFiles. Unlike BackupFiles, errors
+// abort the backup: a partially written entry cannot be skipped in a stream.
+func StreamFiles(archive *compression.Archive, giteaConfig *config.GiteaConfig) error {
+	logger.Info("Starting streaming file backup")
+	
+	sources := []struct {
+		description string
+		path        string
+		name        string
+	}{
+		{"repositories", giteaConfig.Repository.Root, "repo"},
+		{"avatars", giteaConfig.Picture.AvatarUploadPath, "avatars"},
+		{"repository avatars", giteaConfig.Picture.RepositoryAvatarUploadPath, "repo-avatars"},
+	}
+	
+	for _, source := range sources {
+		if source.path == "" {
+			continue
+		}
+		
+		// Not an error if source doesn't exist
+		if _, err := os.Stat(source.path); os.IsNotExist(err) {
+			logger.Debugf("Source directory does not exist: %s", source.path)
+			continue
+		}
+		
+		if err := archive.AddDir(source.path, source.name); err != nil {
+			return fmt.Errorf("failed to backup %s: %w", source.description, err)
+		}
+		logger.Debugf("%s backed up successfully", source.description)
+	}
+	
+	logger.Info("File backup completed")
+	return nil
+}
+
 // RestoreFiles restores Gitea files from backup
 func RestoreFiles(settings *config.Settings, giteaConfig *config.GiteaConfig) error {
 	logger.Info("Starting file restore")
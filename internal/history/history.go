@@ -35,29 +35,71 @@ func Check(settings *config.Settings) (bool, error) {
 		return false, nil
 	}
 	
-	// Check if log file exists
-	if _, err := os.Stat(settings.BackupFileLog); os.IsNotExist(err) {
-		return false, nil
+	found := false
+	err := scan(settings, func(name string) bool {
+		found = name == settings.BackupFilename
+		return !found
+	})
+	if err != nil {
+		return false, err
 	}
 	
+	if found {
+		logger.Infof("Backup filename found in history: %s", settings.BackupFilename)
+	}
+	return found, nil
+}
+
+// Latest returns the last backup filename of the history log, or an empty
+// string if the log is missing or empty
+func Latest(settings *config.Settings) (string, error) {
+	latest := ""
+	err := scan(settings, func(name string) bool {
+		latest = name
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	return latest, nil
+}
+
+// Names returns the set of backup filenames of the history log. A missing
+// log is empty.
+func Names(settings *config.Settings) (map[string]bool, error) {
+	names := make(map[string]bool)
+	err := scan(settings, func(name string) bool {
+		names[name] = true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// scan calls fn with every backup filename of the history log, in order,
+// until fn returns false. A missing log has no filenames.
+func scan(settings *config.Settings, fn func(name string) bool) error {
 	file, err := os.Open(settings.BackupFileLog)
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
-		return false, fmt.Errorf("failed to open backup log file: %w", err)
+		return fmt.Errorf("failed to open backup log file: %w", err)
 	}
 	defer file.Close()
 	
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == settings.BackupFilename {
-			logger.Infof("Backup filename found in history: %s", settings.BackupFilename)
-			return true, nil
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !fn(line) {
+			return nil
 		}
 	}
 	
 	if err := scanner.Err(); err != nil {
-		return false, fmt.Errorf("error reading backup log file: %w", err)
+		return fmt.Errorf("error reading backup log file: %w", err)
 	}
 	
-	return false, nil
-}
\ No newline at end of file
+	return nil
+}
@@ -154,4 +154,64 @@ func TestCheck_WithWhitespace(t *testing.T) {
 	if !found {
 		t.Error("Expected true when backup filename exists (with whitespace), got false")
 	}
-}
\ No newline at end of file
+}
+func TestLatest(t *testing.T) {
+	tmpDir := t.TempDir()
+	logFile := filepath.Join(tmpDir, "backup.log")
+	
+	settings := &config.Settings{
+		BackupFileLog: logFile,
+	}
+	
+	// Missing log file
+	latest, err := history.Latest(settings)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if latest != "" {
+		t.Errorf("Expected no latest backup, got '%s'", latest)
+	}
+	
+	err = os.WriteFile(logFile, []byte("backup-1.zip\nbackup-2.zip\n\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create log file: %v", err)
+	}
+	
+	latest, err = history.Latest(settings)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if latest != "backup-2.zip" {
+		t.Errorf("Expected latest backup 'backup-2.zip', got '%s'", latest)
+	}
+}
+
+func TestNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	logFile := filepath.Join(tmpDir, "backup.log")
+	
+	settings := &config.Settings{
+		BackupFileLog: logFile,
+	}
+	
+	names, err := history.Names(settings)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(names) != 0 {
+		t.Errorf("Expected no names for a missing log, got %v", names)
+	}
+	
+	err = os.WriteFile(logFile, []byte("backup-1.zip\n  backup-2.zip  \n\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to create log file: %v", err)
+	}
+	
+	names, err = history.Names(settings)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(names) != 2 || !names["backup-1.zip"] || !names["backup-2.zip"] {
+		t.Errorf("Unexpected names: %v", names)
+	}
+}
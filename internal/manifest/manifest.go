@@ -0,0 +1,230 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/version"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+// FileName is the name of the manifest at the root of the backup archive
+const FileName = "manifest.json"
+
+// SchemaVersion is the version of the manifest format
+const SchemaVersion = 1
+
+// ErrNotFound is returned when an archive has no manifest, as for backups
+// taken before manifests were introduced
+var ErrNotFound = errors.New("backup has no " + FileName)
+
+// Manifest describes the content of a backup archive
+type Manifest struct {
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Hostname      string    `json:"hostname"`
+	ToolVersion   string    `json:"tool_version"`
+	DBType        string    `json:"db_type"`
+	DumpFile      string    `json:"dump_file"`
+	Files         []Entry   `json:"files"`
+}
+
+// Entry describes one file of the archive
+type Entry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// New returns an empty manifest for a backup of a dbType database dumped to dumpFile
+func New(dbType, dumpFile string) *Manifest {
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Debugf("Failed to read hostname: %v", err)
+	}
+	return &Manifest{
+		SchemaVersion: SchemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Hostname:      hostname,
+		ToolVersion:   version.String(),
+		DBType:        dbType,
+		DumpFile:      dumpFile,
+	}
+}
+
+// Add records a file of the archive
+func (m *Manifest) Add(name string, size int64, sum []byte) {
+	m.Files = append(m.Files, Entry{Name: name, Size: size, SHA256: hex.EncodeToString(sum)})
+}
+
+// Marshal returns the manifest as indented JSON, with files sorted by name
+func (m *Manifest) Marshal() ([]byte, error) {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Name < m.Files[j].Name
+	})
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// Parse decodes a manifest
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", FileName, err)
+	}
+	if m.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("unsupported %s schema version %d", FileName, m.SchemaVersion)
+	}
+	return &m, nil
+}
+
+// Read reads the manifest of an archive extracted to dir
+func Read(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", FileName, err)
+	}
+	return Parse(data)
+}
+
+// Hasher computes the size and SHA-256 of data written to it
+type Hasher struct {
+	hash hash.Hash
+	size int64
+}
+
+// NewHasher returns an empty Hasher
+func NewHasher() *Hasher {
+	return &Hasher{hash: sha256.New()}
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.size += int64(len(p))
+	return h.hash.Write(p)
+}
+
+// Size returns the number of bytes written
+func (h *Hasher) Size() int64 {
+	return h.size
+}
+
+// Sum returns the SHA-256 of the bytes written
+func (h *Hasher) Sum() []byte {
+	return h.hash.Sum(nil)
+}
+
+// Verify checks every file listed in the manifest against the archive
+// extracted to dir, that the dump file is present, and that dir holds no
+// file missing from the manifest. All problems are reported in the returned
+// error.
+func (m *Manifest) Verify(dir string) error {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list extracted files: %w", err)
+	}
+
+	return m.verify(names, func(entry Entry) error {
+		return verifyEntry(dir, entry)
+	})
+}
+
+// VerifyEntries checks every file listed in the manifest against the size
+// and SHA-256 of the files found in an archive read without extracting it,
+// that the dump file is present, and that the archive holds no file missing
+// from the manifest. All problems are reported in the returned error.
+func (m *Manifest) VerifyEntries(found map[string]Entry) error {
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+
+	return m.verify(names, func(entry Entry) error {
+		got, ok := found[entry.Name]
+		if !ok {
+			return fmt.Errorf("%s: missing", entry.Name)
+		}
+		return compareEntry(entry, got.Size, got.SHA256)
+	})
+}
+
+// verify runs check on every file listed in the manifest and reports the
+// names of the archive files, other than the manifest itself, that it does
+// not list
+func (m *Manifest) verify(names []string, check func(entry Entry) error) error {
+	var problems []string
+
+	listed := make(map[string]bool, len(m.Files))
+	for _, entry := range m.Files {
+		listed[entry.Name] = true
+		if err := check(entry); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if m.DumpFile != "" && !listed[m.DumpFile] {
+		problems = append(problems, fmt.Sprintf("%s: database dump is not listed in the manifest", m.DumpFile))
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if name != FileName && !listed[name] {
+			problems = append(problems, fmt.Sprintf("%s: not listed in the manifest", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found checking %d files:\n  %s", len(problems), len(m.Files), strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func verifyEntry(dir string, entry Entry) error {
+	file, err := os.Open(filepath.Join(dir, filepath.FromSlash(entry.Name)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s: missing", entry.Name)
+		}
+		return fmt.Errorf("%s: %v", entry.Name, err)
+	}
+	defer file.Close()
+
+	hasher := NewHasher()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return fmt.Errorf("%s: %v", entry.Name, err)
+	}
+	return compareEntry(entry, hasher.Size(), hex.EncodeToString(hasher.Sum()))
+}
+
+func compareEntry(entry Entry, size int64, sum string) error {
+	if size != entry.Size {
+		return fmt.Errorf("%s: size %d, expected %d", entry.Name, size, entry.Size)
+	}
+	if sum != entry.SHA256 {
+		return fmt.Errorf("%s: sha256 %s, expected %s", entry.Name, sum, entry.SHA256)
+	}
+	return nil
+}
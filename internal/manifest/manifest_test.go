@@ -0,0 +1,125 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) *Manifest {
+	t.Helper()
+	m := New("sqlite3", "dump.sqlite3.db")
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		m.Add(name, int64(len(content)), sum[:])
+	}
+	return m
+}
+
+func TestManifest_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	m := writeFiles(t, dir, map[string]string{
+		"dump.sqlite3.db": "database",
+		"repo/a/HEAD":     "ref: refs/heads/main",
+	})
+
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, FileName), data, 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	read, err := Read(dir)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if read.DBType != "sqlite3" || read.DumpFile != "dump.sqlite3.db" || read.ToolVersion == "" {
+		t.Errorf("Unexpected metadata: %+v", read)
+	}
+	if len(read.Files) != 2 || read.Files[0].Name != "dump.sqlite3.db" {
+		t.Errorf("Expected files sorted by name, got %+v", read.Files)
+	}
+	if err := read.Verify(dir); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestManifest_VerifyReportsEveryProblem(t *testing.T) {
+	dir := t.TempDir()
+	m := writeFiles(t, dir, map[string]string{
+		"dump.sqlite3.db": "database",
+		"repo/a/HEAD":     "ref: refs/heads/main",
+		"repo/a/config":   "[core]",
+	})
+
+	// Same size, different content
+	os.WriteFile(filepath.Join(dir, "dump.sqlite3.db"), []byte("DATABASE"), 0644)
+	// Different size
+	os.WriteFile(filepath.Join(dir, "repo/a/config"), []byte("[core]\n"), 0644)
+	// Missing
+	os.Remove(filepath.Join(dir, "repo/a/HEAD"))
+	// Not listed
+	os.WriteFile(filepath.Join(dir, "repo/a/hooks.sh"), []byte("#!/bin/sh"), 0755)
+
+	err := m.Verify(dir)
+	if err == nil {
+		t.Fatal("Expected verification to fail, got nil")
+	}
+	for _, expected := range []string{"4 problems found checking 3 files", "dump.sqlite3.db: sha256", "repo/a/config: size 7, expected 6", "repo/a/HEAD: missing", "repo/a/hooks.sh: not listed in the manifest"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestManifest_VerifyRequiresDump(t *testing.T) {
+	dir := t.TempDir()
+	m := writeFiles(t, dir, map[string]string{"repo/a/HEAD": "ref"})
+
+	if err := m.Verify(dir); err == nil || !strings.Contains(err.Error(), "database dump") {
+		t.Errorf("Expected missing dump to be reported, got %v", err)
+	}
+}
+
+func TestManifest_VerifyEntriesReportsUnlistedFiles(t *testing.T) {
+	m := writeFiles(t, t.TempDir(), map[string]string{"dump.sqlite3.db": "database"})
+	found := map[string]Entry{
+		FileName:      {Name: FileName},
+		"repo/a/HEAD": {Name: "repo/a/HEAD", Size: 3},
+	}
+	for _, entry := range m.Files {
+		found[entry.Name] = entry
+	}
+
+	err := m.VerifyEntries(found)
+	if err == nil || !strings.Contains(err.Error(), "repo/a/HEAD: not listed in the manifest") {
+		t.Errorf("Expected the unlisted file to be reported, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), FileName) {
+		t.Errorf("Expected %s not to be reported, got %v", FileName, err)
+	}
+}
+
+func TestRead_NotFound(t *testing.T) {
+	if _, err := Read(t.TempDir()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestParse_FutureSchema(t *testing.T) {
+	if _, err := Parse([]byte(`{"schema_version": 99}`)); err == nil {
+		t.Error("Expected error for unsupported schema version, got nil")
+	}
+}
@@ -0,0 +1,274 @@
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Signatures are detached files stored next to the archive, in the spirit of
+// minisign:
+//
+//	untrusted comment: <free text>
+//	base64(algorithm (2 bytes) | key id (8 bytes) | signature (64 bytes))
+//	trusted comment: timestamp:<unix time>\tfile:<archive name>
+//	base64(global signature (64 bytes))
+//
+// The signature is Ed25519ph over the SHA-512 of the archive as stored, so
+// archives can be signed while they are streamed. The key id is the start of
+// the SHA-256 of the public key and tells which key made the signature. The
+// global signature is Ed25519 over the signature followed by the trusted
+// comment, which ties the archive to the name it was uploaded as, so that a
+// signed archive copied over another backup is refused.
+
+// Suffix is appended to the archive name to name its signature
+const Suffix = ".sig"
+
+// algorithm identifies Ed25519ph signatures
+var algorithm = []byte("Ep")
+
+const keyIDSize = 8
+
+const (
+	untrustedPrefix = "untrusted comment: "
+	trustedPrefix   = "trusted comment: "
+)
+
+// ErrBadSignature is returned when a signature does not match the archive
+var ErrBadSignature = errors.New("signature verification failed: the archive was modified or signed by another key")
+
+// ErrNameMismatch is returned when a signature was made for an archive
+// uploaded under another name
+var ErrNameMismatch = errors.New("signature was made for another backup")
+
+// ErrKeyMismatch is returned when a signature was made by a key other than
+// the configured public key
+var ErrKeyMismatch = errors.New("signature was made by a different key than the configured public key")
+
+// prehash are the Ed25519ph signing options
+var prehash = &ed25519.Options{Hash: crypto.SHA512}
+
+// Signer computes the signature of the data written to it
+type Signer struct {
+	key  ed25519.PrivateKey
+	hash hash.Hash
+}
+
+// NewSigner returns a Signer using key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, hash: sha512.New()}
+}
+
+func (s *Signer) Write(p []byte) (int, error) {
+	return s.hash.Write(p)
+}
+
+// Signature returns the signature file content for the data written so far,
+// to be stored next to the archive uploaded as name
+func (s *Signer) Signature(name string) ([]byte, error) {
+	if strings.ContainsAny(name, "\t\r\n") {
+		return nil, fmt.Errorf("cannot sign archive name %q", name)
+	}
+	sig, err := s.key.Sign(nil, s.hash.Sum(nil), prehash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign archive: %w", err)
+	}
+	public := s.key.Public().(ed25519.PublicKey)
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s", time.Now().Unix(), name)
+	global := ed25519.Sign(s.key, append(append([]byte{}, sig...), trusted...))
+
+	raw := append(append(append([]byte{}, algorithm...), keyID(public)...), sig...)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%ssignature from gitea-backup key %s\n", untrustedPrefix, hex.EncodeToString(keyID(public)))
+	buf.WriteString(base64.StdEncoding.EncodeToString(raw) + "\n")
+	buf.WriteString(trustedPrefix + trusted + "\n")
+	buf.WriteString(base64.StdEncoding.EncodeToString(global) + "\n")
+	return buf.Bytes(), nil
+}
+
+// Verify checks the signature file content sig against the data read from
+// r, which must have been signed as name
+func Verify(r io.Reader, sig []byte, public ed25519.PublicKey, name string) error {
+	parsed, err := parseSignature(sig)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(parsed.keyID, keyID(public)) {
+		return fmt.Errorf("%w (signed by %s, expected %s)", ErrKeyMismatch, hex.EncodeToString(parsed.keyID), hex.EncodeToString(keyID(public)))
+	}
+
+	if !ed25519.Verify(public, append(append([]byte{}, parsed.signature...), parsed.trusted...), parsed.global) {
+		return fmt.Errorf("%w: the trusted comment was modified", ErrBadSignature)
+	}
+	signedName := trustedField(parsed.trusted, "file")
+	if signedName != name {
+		return fmt.Errorf("%w: signed as %q, not %q", ErrNameMismatch, signedName, name)
+	}
+
+	digest := sha512.New()
+	if _, err := io.Copy(digest, r); err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	if err := ed25519.VerifyWithOptions(public, digest.Sum(nil), parsed.signature, prehash); err != nil {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// SignFile returns the signature file content for the file at path, to be
+// uploaded as name
+func SignFile(path, name string, key ed25519.PrivateKey) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	signer := NewSigner(key)
+	if _, err := io.Copy(signer, file); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return signer.Signature(name)
+}
+
+// VerifyFile checks the signature file content sig against the file at
+// path, which must have been signed as name
+func VerifyFile(path string, sig []byte, public ed25519.PublicKey, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	return Verify(file, sig, public, name)
+}
+
+// parsedSignature holds the parts of a signature file
+type parsedSignature struct {
+	keyID     []byte
+	signature []byte
+	trusted   string
+	global    []byte
+}
+
+// parseSignature returns the parts of a signature file
+func parseSignature(data []byte) (*parsedSignature, error) {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, untrustedPrefix) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("invalid signature file: no signature found")
+	}
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], trustedPrefix) {
+		return nil, fmt.Errorf("invalid signature file: no trusted comment found")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature file: %w", err)
+	}
+	if len(raw) != len(algorithm)+keyIDSize+ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid signature file: unexpected length %d", len(raw))
+	}
+	if !bytes.Equal(raw[:len(algorithm)], algorithm) {
+		return nil, fmt.Errorf("invalid signature file: unsupported algorithm %q", raw[:len(algorithm)])
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature file: %w", err)
+	}
+	if len(global) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid signature file: unexpected global signature length %d", len(global))
+	}
+
+	return &parsedSignature{
+		keyID:     raw[len(algorithm) : len(algorithm)+keyIDSize],
+		signature: raw[len(algorithm)+keyIDSize:],
+		trusted:   strings.TrimPrefix(lines[1], trustedPrefix),
+		global:    global,
+	}, nil
+}
+
+// trustedField returns the value of the key:value field key of a trusted
+// comment, or an empty string
+func trustedField(trusted, key string) string {
+	for _, field := range strings.Split(trusted, "\t") {
+		if value, ok := strings.CutPrefix(field, key+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func keyID(public ed25519.PublicKey) []byte {
+	sum := sha256.Sum256(public)
+	return sum[:keyIDSize]
+}
+
+// ReadPrivateKey reads a PEM encoded PKCS#8 Ed25519 private key, as written
+// by "openssl genpkey -algorithm ed25519"
+func ReadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an Ed25519 key", path)
+	}
+	return private, nil
+}
+
+// ReadPublicKey reads a PEM encoded PKIX Ed25519 public key, as written by
+// "openssl pkey -pubout"
+func ReadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an Ed25519 key", path)
+	}
+	return public, nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("key file %s does not contain a PEM %q block", path, blockType)
+	}
+	return block.Bytes, nil
+}
@@ -0,0 +1,159 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeys(t *testing.T) (privateFile, publicFile string) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+
+	dir := t.TempDir()
+	privateFile = filepath.Join(dir, "backup.key")
+	publicFile = filepath.Join(dir, "backup.pub")
+	if err := os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+	if err := os.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	return privateFile, publicFile
+}
+
+func readKeys(t *testing.T) (ed25519.PrivateKey, ed25519.PublicKey) {
+	t.Helper()
+	privateFile, publicFile := writeKeys(t)
+	private, err := ReadPrivateKey(privateFile)
+	if err != nil {
+		t.Fatalf("ReadPrivateKey failed: %v", err)
+	}
+	public, err := ReadPublicKey(publicFile)
+	if err != nil {
+		t.Fatalf("ReadPublicKey failed: %v", err)
+	}
+	return private, public
+}
+
+func TestSignVerify(t *testing.T) {
+	private, public := readKeys(t)
+	archive := []byte("archive content")
+
+	signer := NewSigner(private)
+	signer.Write(archive)
+	sig, err := signer.Signature("backup.zip")
+	if err != nil {
+		t.Fatalf("Signature failed: %v", err)
+	}
+	if !strings.HasPrefix(string(sig), "untrusted comment: ") || !strings.Contains(string(sig), "\tfile:backup.zip\n") {
+		t.Errorf("Expected signature to start with a comment and name the archive, got %q", sig)
+	}
+
+	if err := Verify(bytes.NewReader(archive), sig, public, "backup.zip"); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	tampered := []byte("archive c0ntent")
+	if err := Verify(bytes.NewReader(tampered), sig, public, "backup.zip"); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for a modified archive, got %v", err)
+	}
+}
+
+func TestVerify_OtherKey(t *testing.T) {
+	private, _ := readKeys(t)
+	_, otherPublic := readKeys(t)
+
+	signer := NewSigner(private)
+	signer.Write([]byte("archive content"))
+	sig, _ := signer.Signature("backup.zip")
+
+	err := Verify(bytes.NewReader([]byte("archive content")), sig, otherPublic, "backup.zip")
+	if !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("Expected ErrKeyMismatch, got %v", err)
+	}
+}
+
+func TestVerify_RenamedArchive(t *testing.T) {
+	private, public := readKeys(t)
+	archive := []byte("older archive content")
+
+	signer := NewSigner(private)
+	signer.Write(archive)
+	sig, err := signer.Signature("gitea-backup-2024-01-01-00-00-00.zip")
+	if err != nil {
+		t.Fatalf("Signature failed: %v", err)
+	}
+
+	// An older archive and its signature copied over a newer backup
+	err = Verify(bytes.NewReader(archive), sig, public, "gitea-backup-2024-03-15-00-00-00.zip")
+	if !errors.Is(err, ErrNameMismatch) {
+		t.Errorf("Expected ErrNameMismatch for a renamed archive, got %v", err)
+	}
+
+	// The name in the trusted comment cannot be edited to match
+	edited := bytes.Replace(sig, []byte("2024-01-01"), []byte("2024-03-15"), 1)
+	err = Verify(bytes.NewReader(archive), edited, public, "gitea-backup-2024-03-15-00-00-00.zip")
+	if !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for an edited trusted comment, got %v", err)
+	}
+}
+
+func TestVerify_InvalidSignature(t *testing.T) {
+	private, public := readKeys(t)
+	signer := NewSigner(private)
+	sig, _ := signer.Signature("backup.zip")
+	// Without its trusted comment and global signature
+	untrusted := strings.Join(strings.SplitAfter(string(sig), "\n")[:2], "")
+
+	for _, sig := range []string{"", "untrusted comment: nothing\n", "not base64!\n", "dG9vIHNob3J0\n", untrusted} {
+		if err := Verify(bytes.NewReader(nil), []byte(sig), public, "backup.zip"); err == nil {
+			t.Errorf("Expected error for signature %q, got nil", sig)
+		}
+	}
+}
+
+func TestSignVerifyFile(t *testing.T) {
+	private, public := readKeys(t)
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	if err := os.WriteFile(path, []byte("PK\x03\x04 zip content"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	sig, err := SignFile(path, "backup.zip", private)
+	if err != nil {
+		t.Fatalf("SignFile failed: %v", err)
+	}
+	if err := VerifyFile(path, sig, public, "backup.zip"); err != nil {
+		t.Errorf("VerifyFile failed: %v", err)
+	}
+}
+
+func TestReadKeys_WrongType(t *testing.T) {
+	privateFile, publicFile := writeKeys(t)
+
+	if _, err := ReadPrivateKey(publicFile); err == nil {
+		t.Error("Expected error reading a public key as private key, got nil")
+	}
+	if _, err := ReadPublicKey(privateFile); err == nil {
+		t.Error("Expected error reading a private key as public key, got nil")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"sort"
 	"strings"
 	"time"
 
@@ -25,18 +24,31 @@ type FTPConfig struct {
 	Dir      string
 }
 
-// getFTPConfig reads FTP configuration from environment variables
-func getFTPConfig() (*FTPConfig, error) {
+// String formats the FTP configuration for logs, with the password redacted
+func (c FTPConfig) String() string {
+	type ftpConfigFields FTPConfig
+	c.Password = logger.Redact(c.Password)
+	return fmt.Sprintf("%+v", ftpConfigFields(c))
+}
+
+// getFTPConfig reads FTP configuration from environment variables, or the
+// configuration file of settings
+func getFTPConfig(settings *appconfig.Settings) (*FTPConfig, error) {
+	password, err := settings.GetSecret("BACKUP_FTP_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+	
 	return &FTPConfig{
-		Host:     os.Getenv("BACKUP_FTP_HOST"),
-		User:     os.Getenv("BACKUP_FTP_USER"),
-		Password: os.Getenv("BACKUP_FTP_PASSWORD"),
-		Dir:      os.Getenv("BACKUP_FTP_DIR"),
+		Host:     settings.Getenv("BACKUP_FTP_HOST"),
+		User:     settings.Getenv("BACKUP_FTP_USER"),
+		Password: password,
+		Dir:      settings.Getenv("BACKUP_FTP_DIR"),
 	}, nil
 }
 
-func (f *FTPBackend) ValidateConfig() error {
-	ftpConfig, err := getFTPConfig()
+func (f *FTPBackend) ValidateConfig(settings *appconfig.Settings) error {
+	ftpConfig, err := getFTPConfig(settings)
 	if err != nil {
 		return err
 	}
@@ -54,33 +66,34 @@ func (f *FTPBackend) ValidateConfig() error {
 	return nil
 }
 
-func (f *FTPBackend) Upload(settings *appconfig.Settings) error {
-	ftpConfig, err := getFTPConfig()
-	if err != nil {
-		return err
-	}
-	
+// connect dials the FTP server, logs in and changes to the target directory
+func (f *FTPBackend) connect(ftpConfig *FTPConfig) (*ftp.ServerConn, error) {
 	// Connect to FTP server
 	conn, err := ftp.Dial(ftpConfig.Host, ftp.DialWithTimeout(30*time.Second))
 	if err != nil {
-		return fmt.Errorf("failed to connect to FTP server: %w", err)
+		return nil, fmt.Errorf("failed to connect to FTP server: %w", err)
 	}
-	defer conn.Quit()
 	
 	// Login
 	err = conn.Login(ftpConfig.User, ftpConfig.Password)
 	if err != nil {
-		return fmt.Errorf("failed to login to FTP server: %w", err)
+		conn.Quit()
+		return nil, fmt.Errorf("failed to login to FTP server: %w", err)
 	}
 	
 	// Change to target directory if specified
 	if ftpConfig.Dir != "" {
 		err = conn.ChangeDir(ftpConfig.Dir)
 		if err != nil {
-			return fmt.Errorf("failed to change to directory %s: %w", ftpConfig.Dir, err)
+			conn.Quit()
+			return nil, fmt.Errorf("failed to change to directory %s: %w", ftpConfig.Dir, err)
 		}
 	}
 	
+	return conn, nil
+}
+
+func (f *FTPBackend) Upload(settings *appconfig.Settings) error {
 	// Open local file
 	file, err := os.Open(settings.BackupTmpFilename)
 	if err != nil {
@@ -88,150 +101,134 @@ func (f *FTPBackend) Upload(settings *appconfig.Settings) error {
 	}
 	defer file.Close()
 	
+	return f.UploadStream(settings, settings.BackupTmpRemoteFilename, file, -1)
+}
+
+func (f *FTPBackend) UploadStream(settings *appconfig.Settings, name string, r io.Reader, size int64) error {
+	ftpConfig, err := getFTPConfig(settings)
+	if err != nil {
+		return err
+	}
+	
+	conn, err := f.connect(ftpConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Quit()
+	
 	// Upload file
-	err = conn.Stor(settings.BackupTmpRemoteFilename, file)
+	err = conn.Stor(name, r)
 	if err != nil {
+		// Do not leave a truncated archive behind
+		if delErr := conn.Delete(name); delErr != nil {
+			logger.Debugf("Failed to delete incomplete upload %s: %v", name, delErr)
+		}
 		return fmt.Errorf("failed to upload file: %w", err)
 	}
 	
-	logger.Info("Upload to FTP successful")
+	logger.Infof("Upload of %s to FTP successful", name)
 	return nil
 }
 
 func (f *FTPBackend) Download(settings *appconfig.Settings) error {
-	ftpConfig, err := getFTPConfig()
-	if err != nil {
+	if err := downloadToFile(f, settings); err != nil {
 		return err
 	}
 	
-	// Connect to FTP server
-	conn, err := ftp.Dial(ftpConfig.Host, ftp.DialWithTimeout(30*time.Second))
+	logger.Info("Download from FTP successful")
+	return nil
+}
+
+func (f *FTPBackend) DownloadStream(settings *appconfig.Settings, name string) (io.ReadCloser, error) {
+	ftpConfig, err := getFTPConfig(settings)
 	if err != nil {
-		return fmt.Errorf("failed to connect to FTP server: %w", err)
+		return nil, err
 	}
-	defer conn.Quit()
 	
-	// Login
-	err = conn.Login(ftpConfig.User, ftpConfig.Password)
+	conn, err := f.connect(ftpConfig)
 	if err != nil {
-		return fmt.Errorf("failed to login to FTP server: %w", err)
-	}
-	
-	// Change to target directory if specified
-	if ftpConfig.Dir != "" {
-		err = conn.ChangeDir(ftpConfig.Dir)
-		if err != nil {
-			return fmt.Errorf("failed to change to directory %s: %w", ftpConfig.Dir, err)
-		}
-	}
-	
-	// Get remote filename from environment variable
-	remoteFilename := os.Getenv("BACKUP_FILENAME")
-	if remoteFilename == "" {
-		return fmt.Errorf("BACKUP_FILENAME is required for FTP download")
+		return nil, err
 	}
 	
 	// Download file
-	resp, err := conn.Retr(remoteFilename)
+	resp, err := conn.Retr(name)
 	if err != nil {
-		return fmt.Errorf("failed to download file: %w", err)
+		conn.Quit()
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
 	}
-	defer resp.Close()
 	
-	// Create local file
-	file, err := os.Create(settings.RestoreTmpFilename)
+	return &closeFuncReader{ReadCloser: resp, closeFn: func() { conn.Quit() }}, nil
+}
+
+func (f *FTPBackend) List(settings *appconfig.Settings) ([]RemoteBackup, error) {
+	ftpConfig, err := getFTPConfig(settings)
 	if err != nil {
-		return fmt.Errorf("failed to create local file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 	
-	// Copy downloaded content to local file
-	_, err = io.Copy(file, resp)
+	conn, err := f.connect(ftpConfig)
 	if err != nil {
-		return fmt.Errorf("failed to write downloaded content: %w", err)
+		return nil, err
 	}
+	defer conn.Quit()
 	
-	logger.Info("Download from FTP successful")
-	return nil
+	return listFTPBackups(conn, settings.BackupPrefix)
 }
 
 func (f *FTPBackend) EnsureMaxRetention(settings *appconfig.Settings) error {
-	if settings.BackupMaxRetention <= 0 {
+	if !retentionEnabled(settings) {
 		return nil
 	}
 	
-	ftpConfig, err := getFTPConfig()
+	ftpConfig, err := getFTPConfig(settings)
 	if err != nil {
 		return err
 	}
 	
-	// Connect to FTP server
-	conn, err := ftp.Dial(ftpConfig.Host, ftp.DialWithTimeout(30*time.Second))
+	conn, err := f.connect(ftpConfig)
 	if err != nil {
-		return fmt.Errorf("failed to connect to FTP server: %w", err)
+		return err
 	}
 	defer conn.Quit()
 	
-	// Login
-	err = conn.Login(ftpConfig.User, ftpConfig.Password)
+	backupFiles, err := listFTPBackups(conn, settings.BackupPrefix)
 	if err != nil {
-		return fmt.Errorf("failed to login to FTP server: %w", err)
+		return err
 	}
 	
-	// Change to target directory if specified
-	if ftpConfig.Dir != "" {
-		err = conn.ChangeDir(ftpConfig.Dir)
+	// Delete files outside the retention policy
+	for _, name := range expiredBackups(settings, backupFiles) {
+		err = conn.Delete(name)
 		if err != nil {
-			return fmt.Errorf("failed to change to directory %s: %w", ftpConfig.Dir, err)
+			logger.Errorf("Failed to delete file %s: %v", name, err)
+			continue
 		}
+		
+		logger.Infof("Deleted old backup from FTP: %s", name)
 	}
 	
+	return nil
+}
+
+// listFTPBackups lists the files of the current directory starting with prefix
+func listFTPBackups(conn *ftp.ServerConn, prefix string) ([]RemoteBackup, error) {
 	// List files
 	entries, err := conn.List(".")
 	if err != nil {
-		return fmt.Errorf("failed to list files: %w", err)
-	}
-	
-	// Filter files with backup prefix and sort by time
-	var backupFiles []struct {
-		name string
-		time time.Time
+		return nil, fmt.Errorf("failed to list files: %w", err)
 	}
 	
+	// Filter files with backup prefix
+	var backupFiles []RemoteBackup
 	for _, entry := range entries {
-		if entry.Type == ftp.EntryTypeFile && strings.HasPrefix(entry.Name, settings.BackupPrefix) {
-			backupFiles = append(backupFiles, struct {
-				name string
-				time time.Time
-			}{entry.Name, entry.Time})
+		if entry.Type == ftp.EntryTypeFile && strings.HasPrefix(entry.Name, prefix) {
+			backupFiles = append(backupFiles, RemoteBackup{
+				Name:    entry.Name,
+				Size:    int64(entry.Size),
+				ModTime: entry.Time,
+			})
 		}
 	}
 	
-	// Sort files by time (newest first)
-	sort.Slice(backupFiles, func(i, j int) bool {
-		return backupFiles[i].time.After(backupFiles[j].time)
-	})
-	
-	// Delete old files beyond retention limit
-	if len(backupFiles) > settings.BackupMaxRetention {
-		filesToDelete := backupFiles[settings.BackupMaxRetention:]
-		
-		for _, fileInfo := range filesToDelete {
-			// Don't delete the current backup file if it exists
-			backupFilename := os.Getenv("BACKUP_FILENAME")
-			if backupFilename != "" && fileInfo.name == backupFilename {
-				continue
-			}
-			
-			err = conn.Delete(fileInfo.name)
-			if err != nil {
-				logger.Errorf("Failed to delete file %s: %v", fileInfo.name, err)
-				continue
-			}
-			
-			logger.Infof("Deleted old backup from FTP: %s", fileInfo.name)
-		}
-	}
-	
-	return nil
+	return backupFiles, nil
 }
\ No newline at end of file
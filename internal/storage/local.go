@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	appconfig "github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+// LocalBackend implements StorageBackend for a local directory or mounted volume (NFS, SMB, ...)
+type LocalBackend struct{}
+
+// LocalConfig holds local storage configuration
+type LocalConfig struct {
+	Dir string
+}
+
+// getLocalConfig reads local storage configuration from environment
+// variables, or the configuration file of settings
+func getLocalConfig(settings *appconfig.Settings) (*LocalConfig, error) {
+	return &LocalConfig{
+		Dir: settings.Getenv("BACKUP_LOCAL_DIR"),
+	}, nil
+}
+
+func (l *LocalBackend) ValidateConfig(settings *appconfig.Settings) error {
+	localConfig, err := getLocalConfig(settings)
+	if err != nil {
+		return err
+	}
+
+	if localConfig.Dir == "" {
+		return fmt.Errorf("BACKUP_LOCAL_DIR is required for local backend")
+	}
+
+	info, err := os.Stat(localConfig.Dir)
+	if err != nil {
+		return fmt.Errorf("BACKUP_LOCAL_DIR is not accessible: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("BACKUP_LOCAL_DIR is not a directory: %s", localConfig.Dir)
+	}
+
+	return nil
+}
+
+func (l *LocalBackend) Upload(settings *appconfig.Settings) error {
+	// Open local file
+	file, err := os.Open(settings.BackupTmpFilename)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer file.Close()
+
+	return l.UploadStream(settings, settings.BackupTmpRemoteFilename, file, -1)
+}
+
+func (l *LocalBackend) UploadStream(settings *appconfig.Settings, name string, r io.Reader, size int64) error {
+	localConfig, err := getLocalConfig(settings)
+	if err != nil {
+		return err
+	}
+
+	// Write to a hidden temporary file first so that a partial archive never
+	// shows up under its final name (and is never picked up by retention)
+	tmpFile, err := os.CreateTemp(localConfig.Dir, ".upload-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := io.Copy(tmpFile, r); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to sync backup file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close backup file: %w", err)
+	}
+
+	// Atomically move the archive to its final name
+	target := filepath.Join(localConfig.Dir, name)
+	if err := os.Rename(tmpName, target); err != nil {
+		return fmt.Errorf("failed to move backup file into place: %w", err)
+	}
+
+	logger.Infof("Upload of %s to local storage successful", name)
+	return nil
+}
+
+func (l *LocalBackend) Download(settings *appconfig.Settings) error {
+	if err := downloadToFile(l, settings); err != nil {
+		return err
+	}
+
+	logger.Info("Download from local storage successful")
+	return nil
+}
+
+func (l *LocalBackend) DownloadStream(settings *appconfig.Settings, name string) (io.ReadCloser, error) {
+	localConfig, err := getLocalConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open stored file
+	source, err := os.Open(filepath.Join(localConfig.Dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stored backup: %w", err)
+	}
+	return source, nil
+}
+
+func (l *LocalBackend) List(settings *appconfig.Settings) ([]RemoteBackup, error) {
+	localConfig, err := getLocalConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// List files
+	entries, err := os.ReadDir(localConfig.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	// Filter files with backup prefix
+	var backupFiles []RemoteBackup
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasPrefix(entry.Name(), settings.BackupPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", entry.Name(), err)
+		}
+		backupFiles = append(backupFiles, RemoteBackup{
+			Name:    info.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	return backupFiles, nil
+}
+
+func (l *LocalBackend) EnsureMaxRetention(settings *appconfig.Settings) error {
+	if !retentionEnabled(settings) {
+		return nil
+	}
+
+	localConfig, err := getLocalConfig(settings)
+	if err != nil {
+		return err
+	}
+
+	backupFiles, err := l.List(settings)
+	if err != nil {
+		return err
+	}
+
+	// Delete files outside the retention policy
+	for _, name := range expiredBackups(settings, backupFiles) {
+		if err := os.Remove(filepath.Join(localConfig.Dir, name)); err != nil {
+			logger.Errorf("Failed to delete file %s: %v", name, err)
+			continue
+		}
+
+		logger.Infof("Deleted old backup from local storage: %s", name)
+	}
+
+	return nil
+}
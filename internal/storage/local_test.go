@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appconfig "github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+func TestLocalBackend_ValidateConfig(t *testing.T) {
+	backend := &LocalBackend{}
+
+	t.Setenv("BACKUP_LOCAL_DIR", "")
+	if err := backend.ValidateConfig(&appconfig.Settings{}); err == nil {
+		t.Error("Expected error for empty BACKUP_LOCAL_DIR, got nil")
+	}
+
+	t.Setenv("BACKUP_LOCAL_DIR", "/non/existent/dir")
+	if err := backend.ValidateConfig(&appconfig.Settings{}); err == nil {
+		t.Error("Expected error for non-existent BACKUP_LOCAL_DIR, got nil")
+	}
+
+	t.Setenv("BACKUP_LOCAL_DIR", t.TempDir())
+	if err := backend.ValidateConfig(&appconfig.Settings{}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestLocalBackend_UploadDownload(t *testing.T) {
+	targetDir := t.TempDir()
+	localDir := t.TempDir()
+	t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+	content := []byte("backup archive content")
+	backupFile := filepath.Join(localDir, "backup.zip")
+	if err := os.WriteFile(backupFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create backup file: %v", err)
+	}
+
+	settings := &appconfig.Settings{
+		BackupTmpFilename:       backupFile,
+		BackupTmpRemoteFilename: "gitea-backup-2024-01-01-00-00-00.zip",
+		BackupFilename:          "gitea-backup-2024-01-01-00-00-00.zip",
+		RestoreTmpFilename:      filepath.Join(localDir, "restore.zip"),
+	}
+
+	backend := &LocalBackend{}
+	if err := backend.Upload(settings); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	// Only the final archive must be left in the target directory
+	entries, err := os.ReadDir(targetDir)
+	if err != nil {
+		t.Fatalf("Failed to list target dir: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != settings.BackupTmpRemoteFilename {
+		t.Errorf("Expected only %s in target dir, got %v", settings.BackupTmpRemoteFilename, entries)
+	}
+
+	if err := backend.Download(settings); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	downloaded, err := os.ReadFile(settings.RestoreTmpFilename)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if string(downloaded) != string(content) {
+		t.Errorf("Expected downloaded content '%s', got '%s'", content, downloaded)
+	}
+}
+
+func TestLocalBackend_DownloadRequiresFilename(t *testing.T) {
+	t.Setenv("BACKUP_LOCAL_DIR", t.TempDir())
+
+	backend := &LocalBackend{}
+	if err := backend.Download(&appconfig.Settings{}); err == nil {
+		t.Error("Expected error for empty BACKUP_FILENAME, got nil")
+	}
+}
+
+func TestLocalBackend_EnsureMaxRetention(t *testing.T) {
+	targetDir := t.TempDir()
+	t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+	now := time.Now()
+	names := []string{
+		"gitea-backup-1.zip",
+		"gitea-backup-2.zip",
+		"gitea-backup-3.zip",
+	}
+	for i, name := range names {
+		file := filepath.Join(targetDir, name)
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		modTime := now.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set file time: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(targetDir, "other.zip"), []byte("other"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxRetention: 1,
+	}
+
+	backend := &LocalBackend{}
+	if err := backend.EnsureMaxRetention(settings); err != nil {
+		t.Fatalf("EnsureMaxRetention failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"gitea-backup-1.zip": false,
+		"gitea-backup-2.zip": false,
+		"gitea-backup-3.zip": true,
+		"other.zip":          true,
+	}
+	for name, shouldExist := range expected {
+		_, err := os.Stat(filepath.Join(targetDir, name))
+		if exists := err == nil; exists != shouldExist {
+			t.Errorf("Expected %s exists=%v, got %v", name, shouldExist, exists)
+		}
+	}
+}
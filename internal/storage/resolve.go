@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/signing"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+// LatestBackup is the BACKUP_FILENAME value selecting the newest backup
+const LatestBackup = "latest"
+
+// backupDayFormat is the BACKUP_FILENAME layout selecting the newest backup
+// of a day
+const backupDayFormat = "2006-01-02"
+
+// ListBackups returns the backups stored under BackupPrefix, newest first.
+// Signature files are left out.
+func ListBackups(settings *config.Settings) ([]RemoteBackup, error) {
+	backend, err := GetBackend(settings.BackupMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := backend.ValidateConfig(settings); err != nil {
+		return nil, fmt.Errorf("storage configuration validation failed: %w", err)
+	}
+
+	files, err := backend.List(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []RemoteBackup
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name, signing.Suffix) {
+			backups = append(backups, file)
+		}
+	}
+	sortNewestFirst(settings, backups)
+	return backups, nil
+}
+
+// sortNewestFirst sorts backups by the time they were taken, newest first
+func sortNewestFirst(settings *config.Settings, backups []RemoteBackup) {
+	sort.SliceStable(backups, func(i, j int) bool {
+		ti, tj := BackupTime(settings, backups[i]), BackupTime(settings, backups[j])
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return backups[i].Name > backups[j].Name
+	})
+}
+
+// ResolveBackupFilename replaces a BackupFilename of "latest", or of a day
+// such as 2024-03-15, with the name of the newest matching backup under
+// BackupPrefix. Any other BackupFilename is left untouched.
+func ResolveBackupFilename(settings *config.Settings) error {
+	selector := settings.BackupFilename
+	day := ""
+	if _, err := time.ParseInLocation(backupDayFormat, selector, time.Local); err == nil {
+		day = selector
+	} else if selector != LatestBackup {
+		return nil
+	}
+
+	backups, err := ListBackups(settings)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	name := selectBackup(settings, backups, day)
+	if name == "" {
+		if day != "" {
+			return fmt.Errorf("no backup with prefix %q found for %s", settings.BackupPrefix, day)
+		}
+		return fmt.Errorf("no backup with prefix %q found", settings.BackupPrefix)
+	}
+
+	logger.Infof("Resolved BACKUP_FILENAME=%s to %s", selector, name)
+	settings.BackupFilename = name
+	return nil
+}
+
+// selectBackup returns the first of backups, sorted newest first, taken on
+// day, or the first one if day is empty
+func selectBackup(settings *config.Settings, backups []RemoteBackup, day string) string {
+	for _, backup := range backups {
+		if day == "" || BackupTime(settings, backup).In(time.Local).Format(backupDayFormat) == day {
+			return backup.Name
+		}
+	}
+	return ""
+}
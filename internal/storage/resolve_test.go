@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	appconfig "github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+func TestResolveBackupFilename(t *testing.T) {
+	targetDir := t.TempDir()
+	t.Setenv("BACKUP_LOCAL_DIR", targetDir)
+
+	for _, name := range []string{
+		"gitea-backup-2024-03-14-02-00-00.zip",
+		"gitea-backup-2024-03-15-02-00-00.zip",
+		"gitea-backup-2024-03-15-14-00-00.tar.zst",
+		"gitea-backup-2024-03-15-14-00-00.tar.zst.sig",
+		// Signatures are not backups, even when newer than any of them
+		"gitea-backup-2024-03-16-02-00-00.zip.sig",
+		"other-2024-03-17-02-00-00.zip",
+	} {
+		if err := os.WriteFile(filepath.Join(targetDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		filename string
+		want     string
+		wantErr  bool
+	}{
+		{"latest", "gitea-backup-2024-03-15-14-00-00.tar.zst", false},
+		{"2024-03-15", "gitea-backup-2024-03-15-14-00-00.tar.zst", false},
+		{"2024-03-14", "gitea-backup-2024-03-14-02-00-00.zip", false},
+		{"2024-03-20", "", true},
+		{"gitea-backup-2024-03-14-02-00-00.zip", "gitea-backup-2024-03-14-02-00-00.zip", false},
+	}
+
+	for _, tt := range tests {
+		settings := &appconfig.Settings{
+			BackupMethod:   "local",
+			BackupPrefix:   "gitea-backup",
+			BackupFilename: tt.filename,
+		}
+		err := ResolveBackupFilename(settings)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveBackupFilename(%s) error = %v, wantErr %v", tt.filename, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && settings.BackupFilename != tt.want {
+			t.Errorf("ResolveBackupFilename(%s) = %s, want %s", tt.filename, settings.BackupFilename, tt.want)
+		}
+	}
+}
+
+func TestResolveBackupFilename_NoBackup(t *testing.T) {
+	t.Setenv("BACKUP_LOCAL_DIR", t.TempDir())
+
+	settings := &appconfig.Settings{
+		BackupMethod:   "local",
+		BackupPrefix:   "gitea-backup",
+		BackupFilename: LatestBackup,
+	}
+	if err := ResolveBackupFilename(settings); err == nil {
+		t.Error("Expected error without any backup, got nil")
+	}
+}
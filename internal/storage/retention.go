@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appconfig "github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/signing"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+// retentionDecision records whether a backup is kept and why
+type retentionDecision struct {
+	Backup  RemoteBackup
+	Time    time.Time
+	Keep    bool
+	Reasons []string
+}
+
+// gfsRule keeps the newest backup of each of the last Count periods
+type gfsRule struct {
+	Name      string
+	Count     int
+	PeriodKey func(t time.Time) string
+}
+
+// keepRulesEnabled reports whether any count-based rule (last N, GFS) is configured
+func keepRulesEnabled(settings *appconfig.Settings) bool {
+	return settings.BackupMaxRetention > 0 ||
+		settings.BackupKeepDaily > 0 ||
+		settings.BackupKeepWeekly > 0 ||
+		settings.BackupKeepMonthly > 0 ||
+		settings.BackupKeepYearly > 0
+}
+
+// retentionEnabled reports whether any retention rule is configured
+func retentionEnabled(settings *appconfig.Settings) bool {
+	return keepRulesEnabled(settings) ||
+		settings.BackupMaxAge > 0 ||
+		settings.BackupMaxTotalSize > 0
+}
+
+// describeRetention summarizes the configured retention rules for logging
+func describeRetention(settings *appconfig.Settings) string {
+	var rules []string
+	if settings.BackupMaxRetention > 0 {
+		rules = append(rules, fmt.Sprintf("last %d", settings.BackupMaxRetention))
+	}
+	for _, rule := range []struct {
+		name  string
+		count int
+	}{
+		{"daily", settings.BackupKeepDaily},
+		{"weekly", settings.BackupKeepWeekly},
+		{"monthly", settings.BackupKeepMonthly},
+		{"yearly", settings.BackupKeepYearly},
+	} {
+		if rule.count > 0 {
+			rules = append(rules, fmt.Sprintf("%s %d", rule.name, rule.count))
+		}
+	}
+	if settings.BackupMaxAge > 0 {
+		rules = append(rules, "max age "+appconfig.FormatDuration(settings.BackupMaxAge))
+	}
+	if settings.BackupMaxTotalSize > 0 {
+		rules = append(rules, fmt.Sprintf("max total size %d bytes", settings.BackupMaxTotalSize))
+	}
+	return strings.Join(rules, ", ")
+}
+
+// BackupTime returns when a backup was taken. The date embedded in the
+// remote filename is preferred over server modification times, which are
+// reset by copies and some FTP servers.
+func BackupTime(settings *appconfig.Settings, backup RemoteBackup) time.Time {
+	if t, ok := settings.BackupTime(backup.Name); ok {
+		return t
+	}
+	return backup.ModTime
+}
+
+// planRetention evaluates the retention policy against the given backups at
+// time now and returns one decision per backup, newest first.
+//
+// When count-based rules are configured, a backup is a candidate for keeping
+// if any of them selects it:
+//   - it is one of the BackupMaxRetention newest backups
+//   - it is the newest backup of one of the last BackupKeepDaily days,
+//     BackupKeepWeekly ISO weeks, BackupKeepMonthly months or BackupKeepYearly
+//     years (grandfather-father-son)
+//
+// Otherwise every backup is a candidate. Candidates are then dropped if they
+// are older than BackupMaxAge, or once the cumulated size of the newer
+// candidates exceeds BackupMaxTotalSize. The newest backup and the backup
+// currently being restored (BackupFilename) are always kept.
+func planRetention(settings *appconfig.Settings, backups []RemoteBackup, now time.Time) []retentionDecision {
+	decisions := make([]retentionDecision, len(backups))
+	for i, backup := range backups {
+		decisions[i] = retentionDecision{Backup: backup, Time: BackupTime(settings, backup)}
+	}
+
+	// Newest first
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].Time.After(decisions[j].Time)
+	})
+
+	keep := func(d *retentionDecision, reason string) {
+		d.Keep = true
+		d.Reasons = append(d.Reasons, reason)
+	}
+
+	for i := range decisions {
+		if i < settings.BackupMaxRetention {
+			keep(&decisions[i], fmt.Sprintf("one of the %d most recent backups", settings.BackupMaxRetention))
+		}
+	}
+
+	rules := []gfsRule{
+		{"daily", settings.BackupKeepDaily, func(t time.Time) string {
+			return t.Format("2006-01-02")
+		}},
+		{"weekly", settings.BackupKeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{"monthly", settings.BackupKeepMonthly, func(t time.Time) string {
+			return t.Format("2006-01")
+		}},
+		{"yearly", settings.BackupKeepYearly, func(t time.Time) string {
+			return t.Format("2006")
+		}},
+	}
+
+	for _, rule := range rules {
+		if rule.Count <= 0 {
+			continue
+		}
+		periods := 0
+		lastKey := ""
+		for i := range decisions {
+			key := rule.PeriodKey(decisions[i].Time)
+			if key == lastKey {
+				continue
+			}
+			lastKey = key
+			periods++
+			if periods > rule.Count {
+				break
+			}
+			keep(&decisions[i], fmt.Sprintf("%s backup for %s", rule.Name, key))
+		}
+	}
+
+	if !keepRulesEnabled(settings) {
+		for i := range decisions {
+			keep(&decisions[i], "no count limit")
+		}
+	}
+
+	expire := func(d *retentionDecision, reason string) {
+		d.Keep = false
+		d.Reasons = []string{reason}
+	}
+
+	if settings.BackupMaxAge > 0 {
+		cutoff := now.Add(-settings.BackupMaxAge)
+		for i := range decisions {
+			if decisions[i].Keep && decisions[i].Time.Before(cutoff) {
+				expire(&decisions[i], "older than "+appconfig.FormatDuration(settings.BackupMaxAge))
+			}
+		}
+	}
+
+	// The newest and current backups are kept whatever the limits, so they
+	// count against the total size before older backups are admitted
+	forced := func(i int) bool {
+		return i == 0 || (settings.BackupFilename != "" && decisions[i].Backup.Name == settings.BackupFilename)
+	}
+
+	if settings.BackupMaxTotalSize > 0 {
+		var total int64
+		for i := range decisions {
+			if forced(i) {
+				total += decisions[i].Backup.Size
+			}
+		}
+		for i := range decisions {
+			if !decisions[i].Keep || forced(i) {
+				continue
+			}
+			total += decisions[i].Backup.Size
+			if total > settings.BackupMaxTotalSize {
+				expire(&decisions[i], fmt.Sprintf("total size would exceed %d bytes", settings.BackupMaxTotalSize))
+				total -= decisions[i].Backup.Size
+			}
+		}
+	}
+
+	keepAlways := func(d *retentionDecision, reason string) {
+		if !d.Keep {
+			d.Reasons = nil
+		}
+		keep(d, reason)
+	}
+
+	if len(decisions) > 0 {
+		keepAlways(&decisions[0], "newest backup")
+	}
+
+	for i := range decisions {
+		if settings.BackupFilename != "" && decisions[i].Backup.Name == settings.BackupFilename {
+			keepAlways(&decisions[i], "current backup file")
+		}
+	}
+
+	for i := range decisions {
+		if !decisions[i].Keep && len(decisions[i].Reasons) == 0 {
+			decisions[i].Reasons = append(decisions[i].Reasons, "not selected by any retention rule")
+		}
+	}
+
+	return decisions
+}
+
+// expiredBackups returns the names of the backups that fall outside the
+// retention policy, logging the decision taken for each backup. Signature
+// files are not backups: they expire with their archive, or on their own
+// once the archive is gone. In dry-run mode every decision is logged and
+// nothing is returned, so callers delete nothing.
+func expiredBackups(settings *appconfig.Settings, files []RemoteBackup) []string {
+	var backups []RemoteBackup
+	signatures := make(map[string]bool)
+	for _, file := range files {
+		if strings.HasSuffix(file.Name, signing.Suffix) {
+			signatures[file.Name] = true
+		} else {
+			backups = append(backups, file)
+		}
+	}
+
+	var expired []string
+	expiredCount := 0
+	for _, decision := range planRetention(settings, backups, time.Now()) {
+		reasons := strings.Join(decision.Reasons, ", ")
+		switch {
+		case settings.BackupRetentionDryRun && decision.Keep:
+			logger.Infof("[dry-run] keep   %s: %s", decision.Backup.Name, reasons)
+		case settings.BackupRetentionDryRun:
+			logger.Infof("[dry-run] delete %s: %s", decision.Backup.Name, reasons)
+		case decision.Keep:
+			logger.Debugf("Keeping backup %s: %s", decision.Backup.Name, reasons)
+		default:
+			logger.Debugf("Expiring backup %s: %s", decision.Backup.Name, reasons)
+		}
+
+		signature := decision.Backup.Name + signing.Suffix
+		hasSignature := signatures[signature]
+		delete(signatures, signature)
+		if decision.Keep {
+			continue
+		}
+		expiredCount++
+		expired = append(expired, decision.Backup.Name)
+		if hasSignature {
+			expired = append(expired, signature)
+		}
+	}
+
+	// Whatever is left is the signature of an archive that no longer exists
+	orphans := make([]string, 0, len(signatures))
+	for name := range signatures {
+		orphans = append(orphans, name)
+	}
+	sort.Strings(orphans)
+	for _, name := range orphans {
+		if settings.BackupRetentionDryRun {
+			logger.Infof("[dry-run] delete %s: signature of a missing backup", name)
+		} else {
+			logger.Debugf("Expiring signature %s: signature of a missing backup", name)
+		}
+		expired = append(expired, name)
+	}
+
+	if settings.BackupRetentionDryRun {
+		logger.Infof("[dry-run] %d of %d backups would be deleted", expiredCount, len(backups))
+		return nil
+	}
+	return expired
+}
@@ -0,0 +1,312 @@
+package storage
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	appconfig "github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+// dailyBackups returns one backup per day at noon, from start going back count days.
+// Names follow the default "@prefix-@date.zip" template.
+func dailyBackups(start time.Time, count int) []RemoteBackup {
+	var backups []RemoteBackup
+	for i := 0; i < count; i++ {
+		t := start.AddDate(0, 0, -i)
+		backups = append(backups, RemoteBackup{
+			Name: "gitea-backup-" + t.Format(appconfig.BackupDateFormat) + ".zip",
+			Size: 100,
+			// Server times are all identical, as after a bucket copy
+			ModTime: start,
+		})
+	}
+	return backups
+}
+
+func keptNames(decisions []retentionDecision) []string {
+	var names []string
+	for _, decision := range decisions {
+		if decision.Keep {
+			names = append(names, decision.Backup.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRetentionEnabled(t *testing.T) {
+	if retentionEnabled(&appconfig.Settings{}) {
+		t.Error("Expected retention to be disabled without any rule")
+	}
+	if !retentionEnabled(&appconfig.Settings{BackupKeepMonthly: 1}) {
+		t.Error("Expected retention to be enabled with a monthly rule")
+	}
+	if !retentionEnabled(&appconfig.Settings{BackupMaxAge: time.Hour}) {
+		t.Error("Expected retention to be enabled with a maximum age")
+	}
+}
+
+func TestPlanRetention_KeepLast(t *testing.T) {
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxRetention: 2,
+	}
+
+	kept := keptNames(planRetention(settings, dailyBackups(start, 5), start))
+
+	expected := []string{
+		"gitea-backup-2024-03-14-12-00-00.zip",
+		"gitea-backup-2024-03-15-12-00-00.zip",
+	}
+	if len(kept) != len(expected) {
+		t.Fatalf("Expected %v to be kept, got %v", expected, kept)
+	}
+	for i := range expected {
+		if kept[i] != expected[i] {
+			t.Errorf("Expected %v to be kept, got %v", expected, kept)
+		}
+	}
+}
+
+func TestPlanRetention_GFS(t *testing.T) {
+	// Friday 15 March 2024, with one backup a day for ~400 days
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	settings := &appconfig.Settings{
+		BackupPrefix:      "gitea-backup",
+		BackupKeepDaily:   3,
+		BackupKeepWeekly:  2,
+		BackupKeepMonthly: 2,
+		BackupKeepYearly:  2,
+	}
+
+	kept := keptNames(planRetention(settings, dailyBackups(start, 400), start))
+
+	want := map[string]bool{
+		// daily: 15, 14, 13 March
+		"gitea-backup-2024-03-15-12-00-00.zip": true,
+		"gitea-backup-2024-03-14-12-00-00.zip": true,
+		"gitea-backup-2024-03-13-12-00-00.zip": true,
+		// weekly: week 11 (15 March) and week 10 (Sunday 10 March)
+		"gitea-backup-2024-03-10-12-00-00.zip": true,
+		// monthly: March (15 March) and February (29 February)
+		"gitea-backup-2024-02-29-12-00-00.zip": true,
+		// yearly: 2024 (15 March) and 2023 (31 December)
+		"gitea-backup-2023-12-31-12-00-00.zip": true,
+	}
+
+	if len(kept) != len(want) {
+		t.Fatalf("Expected %d backups to be kept, got %d: %v", len(want), len(kept), kept)
+	}
+	for _, name := range kept {
+		if !want[name] {
+			t.Errorf("Unexpected kept backup %s", name)
+		}
+	}
+}
+
+func TestPlanRetention_PrefersNameOverModTime(t *testing.T) {
+	now := time.Now()
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxRetention: 1,
+	}
+
+	backups := []RemoteBackup{
+		// Uploaded last but taken first
+		{Name: "gitea-backup-2024-01-01-00-00-00.zip", ModTime: now},
+		{Name: "gitea-backup-2024-01-02-00-00-00.zip", ModTime: now.Add(-time.Hour)},
+	}
+
+	kept := keptNames(planRetention(settings, backups, now))
+	if len(kept) != 1 || kept[0] != "gitea-backup-2024-01-02-00-00-00.zip" {
+		t.Errorf("Expected only the backup taken last to be kept, got %v", kept)
+	}
+}
+
+func TestPlanRetention_KeepsCurrentBackup(t *testing.T) {
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxRetention: 1,
+		BackupFilename:     "gitea-backup-2024-03-11-12-00-00.zip",
+	}
+
+	kept := keptNames(planRetention(settings, dailyBackups(start, 5), start))
+	if len(kept) != 2 || kept[0] != settings.BackupFilename {
+		t.Errorf("Expected the current backup to be kept, got %v", kept)
+	}
+}
+
+func TestPlanRetention_MaxAge(t *testing.T) {
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	settings := &appconfig.Settings{
+		BackupPrefix: "gitea-backup",
+		BackupMaxAge: 3 * 24 * time.Hour,
+	}
+
+	kept := keptNames(planRetention(settings, dailyBackups(start, 10), start))
+
+	expected := []string{
+		"gitea-backup-2024-03-12-12-00-00.zip",
+		"gitea-backup-2024-03-13-12-00-00.zip",
+		"gitea-backup-2024-03-14-12-00-00.zip",
+		"gitea-backup-2024-03-15-12-00-00.zip",
+	}
+	if len(kept) != len(expected) {
+		t.Fatalf("Expected %v to be kept, got %v", expected, kept)
+	}
+	for i := range expected {
+		if kept[i] != expected[i] {
+			t.Errorf("Expected %v to be kept, got %v", expected, kept)
+		}
+	}
+}
+
+func TestPlanRetention_MaxTotalSize(t *testing.T) {
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxTotalSize: 250,
+	}
+
+	// 100 bytes each: only the two newest fit
+	kept := keptNames(planRetention(settings, dailyBackups(start, 5), start))
+
+	expected := []string{
+		"gitea-backup-2024-03-14-12-00-00.zip",
+		"gitea-backup-2024-03-15-12-00-00.zip",
+	}
+	if len(kept) != len(expected) {
+		t.Fatalf("Expected %v to be kept, got %v", expected, kept)
+	}
+	for i := range expected {
+		if kept[i] != expected[i] {
+			t.Errorf("Expected %v to be kept, got %v", expected, kept)
+		}
+	}
+}
+
+func TestPlanRetention_CombinedRules(t *testing.T) {
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupKeepDaily:    7,
+		BackupKeepMonthly:  3,
+		BackupMaxAge:       30 * 24 * time.Hour,
+		BackupMaxTotalSize: 600,
+	}
+
+	decisions := planRetention(settings, dailyBackups(start, 120), start)
+	kept := keptNames(decisions)
+
+	// The daily rule selects 7 backups and the monthly rule adds February and
+	// January, but January is older than 30 days and the size limit then
+	// only leaves room for 6 of the remaining 8
+	if len(kept) != 6 {
+		t.Fatalf("Expected 6 backups to be kept, got %d: %v", len(kept), kept)
+	}
+	for _, decision := range decisions {
+		if decision.Backup.Name == "gitea-backup-2024-01-31-12-00-00.zip" {
+			if decision.Keep || decision.Reasons[0] != "older than 30d" {
+				t.Errorf("Expected January backup to expire by age, got keep=%v reasons=%v", decision.Keep, decision.Reasons)
+			}
+		}
+	}
+}
+
+func TestPlanRetention_AlwaysKeepsNewest(t *testing.T) {
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxAge:       24 * time.Hour,
+		BackupMaxTotalSize: 50,
+	}
+
+	// Every backup is too old and too large, yet the newest one survives
+	kept := keptNames(planRetention(settings, dailyBackups(start, 5), start.AddDate(0, 1, 0)))
+	if len(kept) != 1 || kept[0] != "gitea-backup-2024-03-15-12-00-00.zip" {
+		t.Errorf("Expected only the newest backup to be kept, got %v", kept)
+	}
+}
+
+func TestPlanRetention_MaxTotalSizeCountsForcedBackups(t *testing.T) {
+	start := time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxTotalSize: 10,
+	}
+
+	// The newest backup alone exceeds the limit, leaving no room for older ones
+	backups := dailyBackups(start, 3)
+	for i, size := range []int64{15, 4, 4} {
+		backups[i].Size = size
+	}
+	kept := keptNames(planRetention(settings, backups, start))
+	if len(kept) != 1 || kept[0] != "gitea-backup-2024-03-15-12-00-00.zip" {
+		t.Errorf("Expected only the newest backup to be kept, got %v", kept)
+	}
+
+	// The current backup file takes its share of the limit as well
+	backups = dailyBackups(start, 4)
+	for i, size := range []int64{4, 4, 4, 5} {
+		backups[i].Size = size
+	}
+	settings.BackupFilename = backups[3].Name
+	kept = keptNames(planRetention(settings, backups, start))
+	expected := []string{
+		"gitea-backup-2024-03-12-12-00-00.zip",
+		"gitea-backup-2024-03-15-12-00-00.zip",
+	}
+	if len(kept) != len(expected) || kept[0] != expected[0] || kept[1] != expected[1] {
+		t.Errorf("Expected %v to be kept, got %v", expected, kept)
+	}
+}
+
+func TestExpiredBackups_DryRun(t *testing.T) {
+	start := time.Now()
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxRetention: 1,
+	}
+
+	if expired := expiredBackups(settings, dailyBackups(start, 3)); len(expired) != 2 {
+		t.Fatalf("Expected 2 expired backups, got %v", expired)
+	}
+
+	settings.BackupRetentionDryRun = true
+	if expired := expiredBackups(settings, dailyBackups(start, 3)); len(expired) != 0 {
+		t.Errorf("Expected nothing to be deleted in dry-run mode, got %v", expired)
+	}
+}
+
+func TestExpiredBackups_Signatures(t *testing.T) {
+	start := time.Now()
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxRetention: 1,
+	}
+
+	backups := dailyBackups(start, 2)
+	files := append([]RemoteBackup{}, backups...)
+	for _, backup := range backups {
+		files = append(files, RemoteBackup{Name: backup.Name + ".sig", Size: 1, ModTime: start})
+	}
+	orphan := "gitea-backup-" + start.AddDate(0, 0, -5).Format(appconfig.BackupDateFormat) + ".zip.sig"
+	files = append(files, RemoteBackup{Name: orphan, Size: 1, ModTime: start})
+
+	expired := expiredBackups(settings, files)
+	sort.Strings(expired)
+	want := []string{backups[1].Name, backups[1].Name + ".sig", orphan}
+	sort.Strings(want)
+	if len(expired) != len(want) {
+		t.Fatalf("Expected %v to expire, got %v", want, expired)
+	}
+	for i := range want {
+		if expired[i] != want[i] {
+			t.Errorf("Expected %v to expire, got %v", want, expired)
+			break
+		}
+	}
+}
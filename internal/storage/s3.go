@@ -3,14 +3,15 @@ package storage
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"sort"
 	"strconv"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/aws/smithy-go/logging"
 
@@ -22,9 +23,24 @@ import (
 	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
 )
 
+// maxS3DeleteBatch is the maximum number of keys accepted by DeleteObjects
+const maxS3DeleteBatch = 1000
+
 // S3Backend implements StorageBackend for Amazon S3 compatible storage
 type S3Backend struct {
-	client *s3.Client
+	client s3API
+}
+
+// s3API is the subset of the S3 client used by S3Backend
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
 }
 
 // S3Config holds S3-specific configuration
@@ -33,45 +49,87 @@ type S3Config struct {
 	AccessKeyID       string
 	SecretAccessKey   string
 	Bucket            string
-	BackupFilename    string
 	Prefix            string
 	SignatureVersion  string
 	Verify            bool
 	Region            string
 	LogDebug          bool
+	PartSize          int64
+	Concurrency       int
 }
 
-// getS3Config reads S3 configuration from environment variables
-func getS3Config() (*S3Config, error) {
+// String formats the S3 configuration for logs, with credentials redacted
+func (c S3Config) String() string {
+	type s3ConfigFields S3Config
+	c.AccessKeyID = logger.Redact(c.AccessKeyID)
+	c.SecretAccessKey = logger.Redact(c.SecretAccessKey)
+	return fmt.Sprintf("%+v", s3ConfigFields(c))
+}
+
+// getS3Config reads S3 configuration from environment variables, or the
+// configuration file of settings
+func getS3Config(settings *appconfig.Settings) (*S3Config, error) {
+	accessKeyID, err := settings.GetSecret("AWS_ACCESS_KEY_ID")
+	if err != nil {
+		return nil, err
+	}
+	secretAccessKey, err := settings.GetSecret("AWS_SECRET_ACCESS_KEY")
+	if err != nil {
+		return nil, err
+	}
+	
 	s3Config := &S3Config{
-		EndpointURL:       os.Getenv("ENDPOINT_URL"),
-		AccessKeyID:       os.Getenv("AWS_ACCESS_KEY_ID"),
-		SecretAccessKey:   os.Getenv("AWS_SECRET_ACCESS_KEY"),
-		Bucket:            os.Getenv("BUCKET"),
-		BackupFilename:    os.Getenv("BACKUP_FILENAME"),
-		Prefix:            os.Getenv("PREFIX"),
+		EndpointURL:       settings.Getenv("ENDPOINT_URL"),
+		AccessKeyID:       accessKeyID,
+		SecretAccessKey:   secretAccessKey,
+		Bucket:            settings.Getenv("BUCKET"),
+		Prefix:            settings.Getenv("PREFIX"),
 		SignatureVersion:  "s3v4",
 		Verify:            true,
-		Region:            os.Getenv("REGION"),
+		Region:            settings.Getenv("REGION"),
 		LogDebug:          false,
+		PartSize:          defaultS3PartSize,
+		Concurrency:       defaultS3Concurrency,
 	}
 	
-	if os.Getenv("VERIFY") == "false" {
+	if settings.Getenv("VERIFY") == "false" {
 		s3Config.Verify = false
 	}
 	
-	if sv := os.Getenv("SIGNATURE_VERSION"); sv != "" {
+	if sv := settings.Getenv("SIGNATURE_VERSION"); sv != "" {
 		s3Config.SignatureVersion = sv
 	}
 	
 	// Parse S3_LOG_DEBUG using strconv.ParseBool for better format support
-	if logDebugEnv := os.Getenv("S3_LOG_DEBUG"); logDebugEnv != "" {
+	if logDebugEnv := settings.Getenv("S3_LOG_DEBUG"); logDebugEnv != "" {
 		if logDebug, err := strconv.ParseBool(logDebugEnv); err == nil {
 			s3Config.LogDebug = logDebug
 		}
 		// Invalid values default to false (already set above)
 	}
 	
+	if partSizeEnv := settings.Getenv("S3_PART_SIZE_MB"); partSizeEnv != "" {
+		partSizeMB, err := strconv.ParseInt(partSizeEnv, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PART_SIZE_MB: %w", err)
+		}
+		if partSizeMB<<20 < minS3PartSize {
+			return nil, fmt.Errorf("invalid S3_PART_SIZE_MB: must be at least %d", minS3PartSize>>20)
+		}
+		s3Config.PartSize = partSizeMB << 20
+	}
+	
+	if concurrencyEnv := settings.Getenv("S3_UPLOAD_CONCURRENCY"); concurrencyEnv != "" {
+		concurrency, err := strconv.Atoi(concurrencyEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_UPLOAD_CONCURRENCY: %w", err)
+		}
+		if concurrency < 1 {
+			return nil, fmt.Errorf("invalid S3_UPLOAD_CONCURRENCY: must be at least 1")
+		}
+		s3Config.Concurrency = concurrency
+	}
+	
 	return s3Config, nil
 }
 
@@ -135,12 +193,12 @@ func restoreIgnored() middleware.FinalizeMiddleware {
 }
 
 // getClient creates and returns an S3 client
-func (s *S3Backend) getClient() (*s3.Client, error) {
+func (s *S3Backend) getClient(settings *appconfig.Settings) (s3API, error) {
 	if s.client != nil {
 		return s.client, nil
 	}
 	
-	s3Config, err := getS3Config()
+	s3Config, err := getS3Config(settings)
 	if err != nil {
 		return nil, err
 	}
@@ -155,11 +213,12 @@ func (s *S3Backend) getClient() (*s3.Client, error) {
 		)),
 	}
 	
-	// Add debug logging options if enabled
+	// Add debug logging options if enabled. Bodies are left out, they hold
+	// the backup itself, and credentials are redacted from the headers.
 	if s3Config.LogDebug {
 		configOptions = append(configOptions,
-			config.WithLogger(logging.NewStandardLogger(os.Stderr)),
-			config.WithClientLogMode(aws.LogRequestWithBody|aws.LogResponseWithBody|aws.LogRetries),
+			config.WithLogger(redactingLogger{logger: logging.NewStandardLogger(os.Stderr)}),
+			config.WithClientLogMode(aws.LogRequest|aws.LogResponse|aws.LogRetries),
 		)
 	}
 	
@@ -174,6 +233,8 @@ func (s *S3Backend) getClient() (*s3.Client, error) {
         UsePathStyle: true,
         Credentials:  cfg.Credentials,
         Region:       s3Config.Region,
+        Logger:       cfg.Logger,
+        ClientLogMode: cfg.ClientLogMode,
 
         RequestChecksumCalculation:  aws.RequestChecksumCalculationWhenRequired,
         ResponseChecksumValidation:  aws.ResponseChecksumValidationWhenRequired,
@@ -186,8 +247,18 @@ func (s *S3Backend) getClient() (*s3.Client, error) {
 	return s.client, nil
 }
 
-func (s *S3Backend) ValidateConfig() error {
-	s3Config, err := getS3Config()
+// redactingLogger passes the SDK debug logs on with credentials and request
+// signatures redacted
+type redactingLogger struct {
+	logger logging.Logger
+}
+
+func (l redactingLogger) Logf(classification logging.Classification, format string, v ...interface{}) {
+	l.logger.Logf(classification, "%s", logger.RedactHTTP(fmt.Sprintf(format, v...)))
+}
+
+func (s *S3Backend) ValidateConfig(settings *appconfig.Settings) error {
+	s3Config, err := getS3Config(settings)
 	if err != nil {
 		return err
 	}
@@ -212,121 +283,161 @@ func (s *S3Backend) ValidateConfig() error {
 }
 
 func (s *S3Backend) Upload(settings *appconfig.Settings) error {
-	client, err := s.getClient()
+	// Open the file to upload
+	file, err := os.Open(settings.BackupTmpFilename)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to open backup file: %w", err)
 	}
+	defer file.Close()
 	
-	s3Config, err := getS3Config()
+	info, err := file.Stat()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to stat backup file: %w", err)
 	}
 	
-	// Open the file to upload
-	file, err := os.Open(settings.BackupTmpFilename)
+	return s.UploadStream(settings, settings.BackupTmpRemoteFilename, file, info.Size())
+}
+
+func (s *S3Backend) UploadStream(settings *appconfig.Settings, name string, r io.Reader, size int64) error {
+	client, err := s.getClient(settings)
 	if err != nil {
-		return fmt.Errorf("failed to open backup file: %w", err)
+		return err
 	}
-	defer file.Close()
-	
-	// Upload to S3
-	_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(s3Config.Bucket),
-		Key:    aws.String(settings.BackupTmpRemoteFilename),
-		Body:   file,
-	})
 	
+	s3Config, err := getS3Config(settings)
 	if err != nil {
+		return err
+	}
+	
+	// Upload to S3, in parallel parts for large archives
+	uploader := &multipartUploader{
+		client:      client,
+		bucket:      s3Config.Bucket,
+		partSize:    s3Config.PartSize,
+		concurrency: s3Config.Concurrency,
+	}
+	if err := uploader.upload(context.TODO(), name, r, size); err != nil {
 		return fmt.Errorf("failed to upload to S3: %w", err)
 	}
 	
-	logger.Info("Upload to S3 successful")
+	logger.Infof("Upload of %s to S3 successful", name)
 	return nil
 }
 
 func (s *S3Backend) Download(settings *appconfig.Settings) error {
-	client, err := s.getClient()
-	if err != nil {
+	if err := downloadToFile(s, settings); err != nil {
 		return err
 	}
 	
-	s3Config, err := getS3Config()
+	logger.Info("Download from S3 successful")
+	return nil
+}
+
+func (s *S3Backend) DownloadStream(settings *appconfig.Settings, name string) (io.ReadCloser, error) {
+	client, err := s.getClient(settings)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	
+	s3Config, err := getS3Config(settings)
+	if err != nil {
+		return nil, err
 	}
 	
 	// Download from S3
 	result, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
 		Bucket: aws.String(s3Config.Bucket),
-		Key:    aws.String(s3Config.BackupFilename),
+		Key:    aws.String(name),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to download from S3: %w", err)
+		return nil, fmt.Errorf("failed to download %s from S3: %w", name, err)
 	}
-	defer result.Body.Close()
 	
-	// Create the local file
-	file, err := os.Create(settings.RestoreTmpFilename)
+	return result.Body, nil
+}
+
+func (s *S3Backend) List(settings *appconfig.Settings) ([]RemoteBackup, error) {
+	client, err := s.getClient(settings)
 	if err != nil {
-		return fmt.Errorf("failed to create local file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
 	
-	// Copy the downloaded content to the local file
-	_, err = file.ReadFrom(result.Body)
+	s3Config, err := getS3Config(settings)
 	if err != nil {
-		return fmt.Errorf("failed to write downloaded content: %w", err)
+		return nil, err
 	}
 	
-	logger.Info("Download from S3 successful")
-	return nil
+	// List all objects with the backup prefix, one page (up to 1000 keys) at a time
+	var backups []RemoteBackup
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s3Config.Bucket),
+		Prefix: aws.String(settings.BackupPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list S3 objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			backups = append(backups, RemoteBackup{
+				Name:    aws.ToString(obj.Key),
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	
+	return backups, nil
 }
 
 func (s *S3Backend) EnsureMaxRetention(settings *appconfig.Settings) error {
-	client, err := s.getClient()
+	client, err := s.getClient(settings)
 	if err != nil {
 		return err
 	}
 	
-	s3Config, err := getS3Config()
+	s3Config, err := getS3Config(settings)
 	if err != nil {
 		return err
 	}
 	
-	// List objects with the backup prefix
-	result, err := client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
-		Bucket: aws.String(s3Config.Bucket),
-		Prefix: aws.String(settings.BackupPrefix),
-	})
+	backups, err := s.List(settings)
 	if err != nil {
-		return fmt.Errorf("failed to list S3 objects: %w", err)
+		return err
 	}
 	
-	// Sort objects by last modified date (newest first)
-	sort.Slice(result.Contents, func(i, j int) bool {
-		return result.Contents[i].LastModified.After(*result.Contents[j].LastModified)
-	})
+	// Collect objects outside the retention policy
+	var toDelete []types.ObjectIdentifier
+	for _, name := range expiredBackups(settings, backups) {
+		toDelete = append(toDelete, types.ObjectIdentifier{Key: aws.String(name)})
+	}
 	
-	// Delete objects beyond the retention limit
-	if len(result.Contents) > settings.BackupMaxRetention {
-		objectsToDelete := result.Contents[settings.BackupMaxRetention:]
+	// Delete in batches, DeleteObjects accepts at most 1000 keys per request
+	for start := 0; start < len(toDelete); start += maxS3DeleteBatch {
+		end := min(start+maxS3DeleteBatch, len(toDelete))
+		batch := toDelete[start:end]
 		
-		for _, obj := range objectsToDelete {
-			// Don't delete the current backup file if it exists
-			if settings.BackupFilename != "" && *obj.Key == settings.BackupFilename {
-				continue
-			}
-			
-			_, err := client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-				Bucket: aws.String(s3Config.Bucket),
-				Key:    obj.Key,
-			})
-			if err != nil {
-				logger.Errorf("Failed to delete object %s: %v", *obj.Key, err)
-				continue
+		result, err := client.DeleteObjects(context.TODO(), &s3.DeleteObjectsInput{
+			Bucket: aws.String(s3Config.Bucket),
+			Delete: &types.Delete{
+				Objects: batch,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			logger.Errorf("Failed to delete %d objects: %v", len(batch), err)
+			continue
+		}
+		
+		failed := make(map[string]bool, len(result.Errors))
+		for _, deleteErr := range result.Errors {
+			failed[aws.ToString(deleteErr.Key)] = true
+			logger.Errorf("Failed to delete object %s: %s", aws.ToString(deleteErr.Key), aws.ToString(deleteErr.Message))
+		}
+		for _, obj := range batch {
+			if !failed[*obj.Key] {
+				logger.Infof("Deleted old backup from S3: %s", *obj.Key)
 			}
-			
-			logger.Infof("Deleted old backup from S3: %s", *obj.Key)
 		}
 	}
 	
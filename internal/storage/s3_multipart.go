@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+const (
+	// S3 rejects parts smaller than 5 MiB (except the last one) and uploads
+	// with more than 10000 parts
+	minS3PartSize = 5 << 20
+	maxS3Parts    = 10000
+
+	defaultS3PartSize    = 64 << 20
+	defaultS3Concurrency = 4
+
+	// firstPartBufferSize is the initial buffer size of the first part of
+	// objects of unknown size
+	firstPartBufferSize = 64 << 10
+)
+
+// multipartUploader uploads objects to S3, splitting anything larger than
+// one part into a multipart upload whose parts are sent concurrently.
+// Memory usage is bounded by partSize * (concurrency + 1).
+type multipartUploader struct {
+	client      s3API
+	bucket      string
+	partSize    int64
+	concurrency int
+}
+
+// upload sends body to key. size is the total length of body, or -1 if unknown.
+func (u *multipartUploader) upload(ctx context.Context, key string, body io.Reader, size int64) error {
+	partSize := u.partSize
+	if size > 0 && (size+partSize-1)/partSize > maxS3Parts {
+		partSize = (size + maxS3Parts - 1) / maxS3Parts
+		logger.Infof("Increasing S3 part size to %d bytes to stay within %d parts", partSize, maxS3Parts)
+	}
+
+	// Read the first part to find out whether a multipart upload is needed at all
+	first, err := readFirstPart(body, partSize, size)
+	n := len(first)
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && int64(n) == size) {
+		logger.Debugf("Uploading %d bytes to S3 in a single request", n)
+		_, err := u.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(u.bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(first),
+		})
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read backup data: %w", err)
+	}
+
+	created, err := u.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(u.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	uploadID := created.UploadId
+
+	parts, err := u.uploadParts(ctx, key, uploadID, first, body, partSize, size)
+	if err != nil {
+		// Use a fresh context: ctx may be the reason we failed
+		_, abortErr := u.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(u.bucket),
+			Key:      aws.String(key),
+			UploadId: uploadID,
+		})
+		if abortErr != nil {
+			logger.Errorf("Failed to abort multipart upload %s: %v", aws.ToString(uploadID), abortErr)
+		} else {
+			logger.Infof("Aborted incomplete multipart upload %s", aws.ToString(uploadID))
+		}
+		return err
+	}
+
+	_, err = u.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(u.bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	return nil
+}
+
+// readFirstPart reads up to partSize bytes of body like io.ReadFull, into a
+// buffer that grows with the data read, so that small objects such as
+// signatures do not cost a whole part. size is the total length of body, or
+// -1 if unknown. The buffer never grows beyond partSize, so that it can be
+// recycled as a part buffer.
+func readFirstPart(body io.Reader, partSize, size int64) ([]byte, error) {
+	capacity := min(partSize, firstPartBufferSize)
+	if size >= 0 {
+		// One more byte finds the end of body without growing the buffer
+		capacity = min(partSize, size+1)
+	}
+	buf := make([]byte, 0, capacity)
+	for int64(len(buf)) < partSize {
+		if len(buf) == cap(buf) {
+			grown := make([]byte, len(buf), min(2*int64(cap(buf)), partSize))
+			copy(grown, buf)
+			buf = grown
+		}
+		n, err := body.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			if len(buf) == 0 {
+				return buf, io.EOF
+			}
+			return buf, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+// uploadParts reads body part by part and uploads up to u.concurrency parts
+// at a time. first holds the already-read first part.
+func (u *multipartUploader) uploadParts(ctx context.Context, key string, uploadID *string, first []byte, body io.Reader, partSize, size int64) ([]types.CompletedPart, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := u.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// slots bounds the number of parts in flight, free recycles part buffers
+	slots := make(chan struct{}, concurrency)
+	free := make(chan []byte, concurrency+1)
+	getBuffer := func() []byte {
+		select {
+		case buf := <-free:
+			return buf
+		default:
+			return make([]byte, partSize)
+		}
+	}
+	putBuffer := func(buf []byte) {
+		select {
+		case free <- buf[:cap(buf)]:
+		default:
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		parts    []types.CompletedPart
+		firstErr error
+	)
+	progress := newUploadProgress(size)
+
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+
+	data := first
+	for partNumber := int32(1); ; partNumber++ {
+		if partNumber > maxS3Parts {
+			fail(fmt.Errorf("backup exceeds %d parts of %d bytes", maxS3Parts, partSize))
+			break
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(partNumber int32, data []byte) {
+			defer wg.Done()
+			defer func() {
+				putBuffer(data)
+				<-slots
+			}()
+
+			out, err := u.client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:     aws.String(u.bucket),
+				Key:        aws.String(key),
+				UploadId:   uploadID,
+				PartNumber: aws.Int32(partNumber),
+				Body:       bytes.NewReader(data),
+			})
+			if err != nil {
+				fail(fmt.Errorf("failed to upload part %d: %w", partNumber, err))
+				return
+			}
+
+			mu.Lock()
+			parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(partNumber)})
+			mu.Unlock()
+			progress.add(int64(len(data)))
+		}(partNumber, data)
+
+		// Read the next part while the previous ones are uploading
+		buf := getBuffer()
+		n, err := io.ReadFull(body, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			fail(fmt.Errorf("failed to read backup data: %w", err))
+			break
+		}
+		data = buf[:n]
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(parts, func(i, j int) bool {
+		return *parts[i].PartNumber < *parts[j].PartNumber
+	})
+
+	return parts, nil
+}
+
+// uploadProgress reports upload progress through the logger
+type uploadProgress struct {
+	mu       sync.Mutex
+	total    int64
+	uploaded int64
+	reported int64
+}
+
+func newUploadProgress(total int64) *uploadProgress {
+	return &uploadProgress{total: total}
+}
+
+func (p *uploadProgress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.uploaded += n
+	if p.total > 0 {
+		// Report every 10%
+		percent := p.uploaded * 100 / p.total
+		if percent/10 > p.reported/10 || p.uploaded == p.total {
+			p.reported = percent
+			logger.Infof("Uploaded %d MiB of %d MiB to S3 (%d%%)", p.uploaded>>20, p.total>>20, percent)
+		}
+		return
+	}
+	logger.Infof("Uploaded %d MiB to S3", p.uploaded>>20)
+}
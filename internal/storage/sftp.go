@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	appconfig "github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+// SFTPBackend implements StorageBackend for SFTP (SSH File Transfer Protocol)
+type SFTPBackend struct{}
+
+// SFTPConfig holds SFTP-specific configuration
+type SFTPConfig struct {
+	Host                 string
+	User                 string
+	Password             string
+	PrivateKey           string
+	PrivateKeyPassphrase string
+	KnownHosts           string
+	Dir                  string
+}
+
+// String formats the SFTP configuration for logs, with the password and key
+// passphrase redacted
+func (c SFTPConfig) String() string {
+	type sftpConfigFields SFTPConfig
+	c.Password = logger.Redact(c.Password)
+	c.PrivateKeyPassphrase = logger.Redact(c.PrivateKeyPassphrase)
+	return fmt.Sprintf("%+v", sftpConfigFields(c))
+}
+
+// getSFTPConfig reads SFTP configuration from environment variables, or the
+// configuration file of settings
+func getSFTPConfig(settings *appconfig.Settings) (*SFTPConfig, error) {
+	password, err := settings.GetSecret("BACKUP_SFTP_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := settings.GetSecret("BACKUP_SFTP_PRIVATE_KEY_PASSPHRASE")
+	if err != nil {
+		return nil, err
+	}
+
+	sftpConfig := &SFTPConfig{
+		Host:                 settings.Getenv("BACKUP_SFTP_HOST"),
+		User:                 settings.Getenv("BACKUP_SFTP_USER"),
+		Password:             password,
+		PrivateKey:           settings.Getenv("BACKUP_SFTP_PRIVATE_KEY"),
+		PrivateKeyPassphrase: passphrase,
+		KnownHosts:           settings.Getenv("BACKUP_SFTP_KNOWN_HOSTS"),
+		Dir:                  settings.Getenv("BACKUP_SFTP_DIR"),
+	}
+
+	// Default to the standard OpenSSH port when none is given
+	if sftpConfig.Host != "" {
+		if _, _, err := net.SplitHostPort(sftpConfig.Host); err != nil {
+			sftpConfig.Host = net.JoinHostPort(sftpConfig.Host, "22")
+		}
+	}
+
+	// Default to the user's known_hosts file
+	if sftpConfig.KnownHosts == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			sftpConfig.KnownHosts = filepath.Join(home, ".ssh", "known_hosts")
+		}
+	}
+
+	return sftpConfig, nil
+}
+
+func (s *SFTPBackend) ValidateConfig(settings *appconfig.Settings) error {
+	sftpConfig, err := getSFTPConfig(settings)
+	if err != nil {
+		return err
+	}
+
+	if sftpConfig.Host == "" {
+		return fmt.Errorf("BACKUP_SFTP_HOST is required for SFTP backend")
+	}
+	if sftpConfig.User == "" {
+		return fmt.Errorf("BACKUP_SFTP_USER is required for SFTP backend")
+	}
+	if sftpConfig.Password == "" && sftpConfig.PrivateKey == "" {
+		return fmt.Errorf("BACKUP_SFTP_PASSWORD or BACKUP_SFTP_PRIVATE_KEY is required for SFTP backend")
+	}
+	if sftpConfig.KnownHosts == "" {
+		return fmt.Errorf("BACKUP_SFTP_KNOWN_HOSTS is required for SFTP backend")
+	}
+
+	return nil
+}
+
+// connect opens an SSH connection and starts an SFTP session on top of it.
+// The returned function closes both.
+func (s *SFTPBackend) connect(sftpConfig *SFTPConfig) (*sftp.Client, func(), error) {
+	var auth []ssh.AuthMethod
+
+	if sftpConfig.PrivateKey != "" {
+		keyBytes, err := os.ReadFile(sftpConfig.PrivateKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+
+		var signer ssh.Signer
+		if sftpConfig.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(sftpConfig.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(keyBytes)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if sftpConfig.Password != "" {
+		auth = append(auth, ssh.Password(sftpConfig.Password))
+	}
+
+	hostKeyCallback, err := knownhosts.New(sftpConfig.KnownHosts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load known_hosts file %s: %w", sftpConfig.KnownHosts, err)
+	}
+
+	sshClient, err := ssh.Dial("tcp", sftpConfig.Host, &ssh.ClientConfig{
+		User:            sftpConfig.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to SFTP server: %w", err)
+	}
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, nil, fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+
+	closeFn := func() {
+		client.Close()
+		sshClient.Close()
+	}
+
+	return client, closeFn, nil
+}
+
+// remotePath returns the path of name inside the configured remote directory
+func (c *SFTPConfig) remotePath(name string) string {
+	if c.Dir == "" {
+		return name
+	}
+	return path.Join(c.Dir, name)
+}
+
+func (s *SFTPBackend) Upload(settings *appconfig.Settings) error {
+	// Open local file
+	file, err := os.Open(settings.BackupTmpFilename)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer file.Close()
+
+	return s.UploadStream(settings, settings.BackupTmpRemoteFilename, file, -1)
+}
+
+func (s *SFTPBackend) UploadStream(settings *appconfig.Settings, name string, r io.Reader, size int64) error {
+	sftpConfig, err := getSFTPConfig(settings)
+	if err != nil {
+		return err
+	}
+
+	client, closeFn, err := s.connect(sftpConfig)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	// Create remote file
+	remotePath := sftpConfig.remotePath(name)
+	remoteFile, err := client.Create(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file: %w", err)
+	}
+
+	// Upload file
+	_, err = io.Copy(remoteFile, r)
+	if closeErr := remoteFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Do not leave a truncated archive behind
+		if rmErr := client.Remove(remotePath); rmErr != nil {
+			logger.Debugf("Failed to delete incomplete upload %s: %v", remotePath, rmErr)
+		}
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	logger.Infof("Upload of %s to SFTP successful", name)
+	return nil
+}
+
+func (s *SFTPBackend) Download(settings *appconfig.Settings) error {
+	if err := downloadToFile(s, settings); err != nil {
+		return err
+	}
+
+	logger.Info("Download from SFTP successful")
+	return nil
+}
+
+func (s *SFTPBackend) DownloadStream(settings *appconfig.Settings, name string) (io.ReadCloser, error) {
+	sftpConfig, err := getSFTPConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	client, closeFn, err := s.connect(sftpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open remote file
+	remoteFile, err := client.Open(sftpConfig.remotePath(name))
+	if err != nil {
+		closeFn()
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+
+	return &closeFuncReader{ReadCloser: remoteFile, closeFn: closeFn}, nil
+}
+
+func (s *SFTPBackend) List(settings *appconfig.Settings) ([]RemoteBackup, error) {
+	sftpConfig, err := getSFTPConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	client, closeFn, err := s.connect(sftpConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	return sftpConfig.listBackups(client, settings.BackupPrefix)
+}
+
+func (s *SFTPBackend) EnsureMaxRetention(settings *appconfig.Settings) error {
+	if !retentionEnabled(settings) {
+		return nil
+	}
+
+	sftpConfig, err := getSFTPConfig(settings)
+	if err != nil {
+		return err
+	}
+
+	client, closeFn, err := s.connect(sftpConfig)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	backupFiles, err := sftpConfig.listBackups(client, settings.BackupPrefix)
+	if err != nil {
+		return err
+	}
+
+	// Delete files outside the retention policy
+	for _, name := range expiredBackups(settings, backupFiles) {
+		if err := client.Remove(sftpConfig.remotePath(name)); err != nil {
+			logger.Errorf("Failed to delete file %s: %v", name, err)
+			continue
+		}
+
+		logger.Infof("Deleted old backup from SFTP: %s", name)
+	}
+
+	return nil
+}
+
+// listBackups lists the files of the remote directory starting with prefix
+func (c *SFTPConfig) listBackups(client *sftp.Client, prefix string) ([]RemoteBackup, error) {
+	// List files
+	dir := c.Dir
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := client.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	// Filter files with backup prefix
+	var backupFiles []RemoteBackup
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && strings.HasPrefix(entry.Name(), prefix) {
+			backupFiles = append(backupFiles, RemoteBackup{
+				Name:    entry.Name(),
+				Size:    entry.Size(),
+				ModTime: entry.ModTime(),
+			})
+		}
+	}
+	return backupFiles, nil
+}
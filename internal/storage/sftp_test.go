@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	appconfig "github.com/Frantche/gitea-backup-restore-process/internal/config"
+)
+
+// testSFTPServer is an in-process SSH server exposing the sftp subsystem
+// on top of the local filesystem.
+type testSFTPServer struct {
+	addr       string
+	knownHosts string
+	clientKey  string
+}
+
+func newTestSFTPServer(t *testing.T, password string) *testSFTPServer {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatalf("Failed to create host signer: %v", err)
+	}
+
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate client key: %v", err)
+	}
+	authorizedKey, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatalf("Failed to create client public key: %v", err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == "backup" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "backup" && string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTPConn(conn, serverConfig)
+		}
+	}()
+
+	addr := listener.Addr().String()
+
+	knownHosts := filepath.Join(tmpDir, "known_hosts")
+	line := knownhosts.Line([]string{addr}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write known_hosts: %v", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatalf("Failed to marshal client key: %v", err)
+	}
+	clientKey := filepath.Join(tmpDir, "id_ed25519")
+	if err := os.WriteFile(clientKey, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write client key: %v", err)
+	}
+
+	return &testSFTPServer{addr: addr, knownHosts: knownHosts, clientKey: clientKey}
+}
+
+func serveSFTPConn(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	defer conn.Close()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				// The payload is a length-prefixed subsystem name
+				req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}(requests)
+
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			channel.Close()
+			continue
+		}
+		go func() {
+			server.Serve()
+			server.Close()
+		}()
+	}
+}
+
+func setSFTPEnv(t *testing.T, server *testSFTPServer, remoteDir string) {
+	t.Helper()
+	t.Setenv("BACKUP_SFTP_HOST", server.addr)
+	t.Setenv("BACKUP_SFTP_USER", "backup")
+	t.Setenv("BACKUP_SFTP_PASSWORD", "")
+	t.Setenv("BACKUP_SFTP_PRIVATE_KEY", "")
+	t.Setenv("BACKUP_SFTP_PRIVATE_KEY_PASSPHRASE", "")
+	t.Setenv("BACKUP_SFTP_KNOWN_HOSTS", server.knownHosts)
+	t.Setenv("BACKUP_SFTP_DIR", remoteDir)
+}
+
+func TestGetSFTPConfig_DefaultPort(t *testing.T) {
+	t.Setenv("BACKUP_SFTP_HOST", "backup.example.com")
+
+	config, err := getSFTPConfig(&appconfig.Settings{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if config.Host != "backup.example.com:22" {
+		t.Errorf("Expected Host to be 'backup.example.com:22', got %v", config.Host)
+	}
+}
+
+func TestSFTPBackend_ValidateConfig(t *testing.T) {
+	t.Setenv("BACKUP_SFTP_HOST", "backup.example.com")
+	t.Setenv("BACKUP_SFTP_USER", "backup")
+	t.Setenv("BACKUP_SFTP_PASSWORD", "")
+	t.Setenv("BACKUP_SFTP_PRIVATE_KEY", "")
+	t.Setenv("BACKUP_SFTP_KNOWN_HOSTS", "/tmp/known_hosts")
+
+	backend := &SFTPBackend{}
+	if err := backend.ValidateConfig(&appconfig.Settings{}); err == nil {
+		t.Error("Expected error when neither password nor private key is set, got nil")
+	}
+
+	t.Setenv("BACKUP_SFTP_PASSWORD", "secret")
+	if err := backend.ValidateConfig(&appconfig.Settings{}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestSFTPBackend_UploadDownloadWithPassword(t *testing.T) {
+	server := newTestSFTPServer(t, "secret")
+	remoteDir := t.TempDir()
+	localDir := t.TempDir()
+
+	setSFTPEnv(t, server, remoteDir)
+	t.Setenv("BACKUP_SFTP_PASSWORD", "secret")
+
+	content := []byte("backup archive content")
+	backupFile := filepath.Join(localDir, "backup.zip")
+	if err := os.WriteFile(backupFile, content, 0644); err != nil {
+		t.Fatalf("Failed to create backup file: %v", err)
+	}
+
+	settings := &appconfig.Settings{
+		BackupTmpFilename:       backupFile,
+		BackupTmpRemoteFilename: "gitea-backup-2024-01-01-00-00-00.zip",
+		BackupFilename:          "gitea-backup-2024-01-01-00-00-00.zip",
+		RestoreTmpFilename:      filepath.Join(localDir, "restore.zip"),
+	}
+
+	backend := &SFTPBackend{}
+	if err := backend.Upload(settings); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	uploaded, err := os.ReadFile(filepath.Join(remoteDir, settings.BackupTmpRemoteFilename))
+	if err != nil {
+		t.Fatalf("Uploaded file not found on server: %v", err)
+	}
+	if string(uploaded) != string(content) {
+		t.Errorf("Expected uploaded content '%s', got '%s'", content, uploaded)
+	}
+
+	if err := backend.Download(settings); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	downloaded, err := os.ReadFile(settings.RestoreTmpFilename)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if string(downloaded) != string(content) {
+		t.Errorf("Expected downloaded content '%s', got '%s'", content, downloaded)
+	}
+}
+
+func TestSFTPBackend_PrivateKeyAuth(t *testing.T) {
+	server := newTestSFTPServer(t, "secret")
+	remoteDir := t.TempDir()
+	localDir := t.TempDir()
+
+	setSFTPEnv(t, server, remoteDir)
+	t.Setenv("BACKUP_SFTP_PRIVATE_KEY", server.clientKey)
+
+	backupFile := filepath.Join(localDir, "backup.zip")
+	if err := os.WriteFile(backupFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create backup file: %v", err)
+	}
+
+	settings := &appconfig.Settings{
+		BackupTmpFilename:       backupFile,
+		BackupTmpRemoteFilename: "gitea-backup.zip",
+	}
+
+	backend := &SFTPBackend{}
+	if err := backend.Upload(settings); err != nil {
+		t.Fatalf("Upload with private key failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(remoteDir, "gitea-backup.zip")); err != nil {
+		t.Errorf("Expected uploaded file on server, got %v", err)
+	}
+}
+
+func TestSFTPBackend_UnknownHostKey(t *testing.T) {
+	server := newTestSFTPServer(t, "secret")
+	other := newTestSFTPServer(t, "secret")
+
+	setSFTPEnv(t, server, t.TempDir())
+	t.Setenv("BACKUP_SFTP_PASSWORD", "secret")
+	// known_hosts of another server must not be accepted
+	t.Setenv("BACKUP_SFTP_KNOWN_HOSTS", other.knownHosts)
+
+	backupFile := filepath.Join(t.TempDir(), "backup.zip")
+	if err := os.WriteFile(backupFile, []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to create backup file: %v", err)
+	}
+
+	settings := &appconfig.Settings{
+		BackupTmpFilename:       backupFile,
+		BackupTmpRemoteFilename: "gitea-backup.zip",
+	}
+
+	backend := &SFTPBackend{}
+	if err := backend.Upload(settings); err == nil {
+		t.Fatal("Expected host key verification error, got nil")
+	}
+}
+
+func TestSFTPBackend_EnsureMaxRetention(t *testing.T) {
+	server := newTestSFTPServer(t, "secret")
+	remoteDir := t.TempDir()
+
+	setSFTPEnv(t, server, remoteDir)
+	t.Setenv("BACKUP_SFTP_PASSWORD", "secret")
+
+	now := time.Now()
+	names := []string{
+		"gitea-backup-1.zip",
+		"gitea-backup-2.zip",
+		"gitea-backup-3.zip",
+		"gitea-backup-4.zip",
+	}
+	for i, name := range names {
+		file := filepath.Join(remoteDir, name)
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create remote file: %v", err)
+		}
+		modTime := now.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set file time: %v", err)
+		}
+	}
+	// Files without the prefix are left alone
+	if err := os.WriteFile(filepath.Join(remoteDir, "other.zip"), []byte("other"), 0644); err != nil {
+		t.Fatalf("Failed to create remote file: %v", err)
+	}
+
+	settings := &appconfig.Settings{
+		BackupPrefix:       "gitea-backup",
+		BackupMaxRetention: 2,
+	}
+
+	backend := &SFTPBackend{}
+	if err := backend.EnsureMaxRetention(settings); err != nil {
+		t.Fatalf("EnsureMaxRetention failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"gitea-backup-1.zip": false,
+		"gitea-backup-2.zip": false,
+		"gitea-backup-3.zip": true,
+		"gitea-backup-4.zip": true,
+		"other.zip":          true,
+	}
+	for name, shouldExist := range expected {
+		_, err := os.Stat(filepath.Join(remoteDir, name))
+		if exists := err == nil; exists != shouldExist {
+			t.Errorf("Expected %s exists=%v, got %v", name, shouldExist, exists)
+		}
+	}
+}
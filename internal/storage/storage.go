@@ -2,6 +2,10 @@ package storage
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"time"
+
 	"github.com/Frantche/gitea-backup-restore-process/internal/config"
 	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
 )
@@ -9,9 +13,25 @@ import (
 // StorageBackend defines the interface for remote storage operations
 type StorageBackend interface {
 	Upload(settings *config.Settings) error
+	// UploadStream uploads the content read from r as name. size is the
+	// length of the content, or -1 if unknown.
+	UploadStream(settings *config.Settings, name string, r io.Reader, size int64) error
 	Download(settings *config.Settings) error
+	// DownloadStream opens the remote file name for reading. The caller
+	// must close it.
+	DownloadStream(settings *config.Settings, name string) (io.ReadCloser, error)
+	// List returns every file whose name starts with BackupPrefix, in no
+	// particular order
+	List(settings *config.Settings) ([]RemoteBackup, error)
 	EnsureMaxRetention(settings *config.Settings) error
-	ValidateConfig() error
+	ValidateConfig(settings *config.Settings) error
+}
+
+// RemoteBackup describes a file stored on a backend
+type RemoteBackup struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
 }
 
 // GetBackend returns the appropriate storage backend based on the backup method
@@ -21,6 +41,10 @@ func GetBackend(method string) (StorageBackend, error) {
 		return &S3Backend{}, nil
 	case "ftp":
 		return &FTPBackend{}, nil
+	case "sftp":
+		return &SFTPBackend{}, nil
+	case "local":
+		return &LocalBackend{}, nil
 	default:
 		return nil, fmt.Errorf("unsupported storage backend: %s", method)
 	}
@@ -29,13 +53,15 @@ func GetBackend(method string) (StorageBackend, error) {
 // Upload uploads the backup file to remote storage
 func Upload(settings *config.Settings) error {
 	logger.Infof("Starting upload to %s", settings.BackupMethod)
+	log := logger.With("backend", settings.BackupMethod)
+	start := time.Now()
 	
 	backend, err := GetBackend(settings.BackupMethod)
 	if err != nil {
 		return err
 	}
 	
-	if err := backend.ValidateConfig(); err != nil {
+	if err := backend.ValidateConfig(settings); err != nil {
 		return fmt.Errorf("storage configuration validation failed: %w", err)
 	}
 	
@@ -43,20 +69,46 @@ func Upload(settings *config.Settings) error {
 		return fmt.Errorf("upload failed: %w", err)
 	}
 	
-	logger.Info("Upload completed successfully")
+	log.Info("Upload completed successfully", "duration", time.Since(start))
+	return nil
+}
+
+// UploadStream uploads content read from r to remote storage as name, without
+// staging it on disk. size is the length of the content, or -1 if unknown.
+func UploadStream(settings *config.Settings, name string, r io.Reader, size int64) error {
+	logger.Infof("Starting streaming upload of %s to %s", name, settings.BackupMethod)
+	log := logger.With("backend", settings.BackupMethod)
+	start := time.Now()
+	
+	backend, err := GetBackend(settings.BackupMethod)
+	if err != nil {
+		return err
+	}
+	
+	if err := backend.ValidateConfig(settings); err != nil {
+		return fmt.Errorf("storage configuration validation failed: %w", err)
+	}
+	
+	if err := backend.UploadStream(settings, name, r, size); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	
+	log.Info("Upload completed successfully", "duration", time.Since(start))
 	return nil
 }
 
 // Download downloads the backup file from remote storage
 func Download(settings *config.Settings) error {
 	logger.Infof("Starting download from %s", settings.BackupMethod)
+	log := logger.With("backend", settings.BackupMethod)
+	start := time.Now()
 	
 	backend, err := GetBackend(settings.BackupMethod)
 	if err != nil {
 		return err
 	}
 	
-	if err := backend.ValidateConfig(); err != nil {
+	if err := backend.ValidateConfig(settings); err != nil {
 		return fmt.Errorf("storage configuration validation failed: %w", err)
 	}
 	
@@ -64,25 +116,81 @@ func Download(settings *config.Settings) error {
 		return fmt.Errorf("download failed: %w", err)
 	}
 	
-	logger.Info("Download completed successfully")
+	log.Info("Download completed successfully", "duration", time.Since(start))
 	return nil
 }
 
+// DownloadStream opens the remote file name for reading. The caller must close it.
+func DownloadStream(settings *config.Settings, name string) (io.ReadCloser, error) {
+	backend, err := GetBackend(settings.BackupMethod)
+	if err != nil {
+		return nil, err
+	}
+	
+	if err := backend.ValidateConfig(settings); err != nil {
+		return nil, fmt.Errorf("storage configuration validation failed: %w", err)
+	}
+	
+	return backend.DownloadStream(settings, name)
+}
+
+// downloadToFile downloads BackupFilename to RestoreTmpFilename
+func downloadToFile(backend StorageBackend, settings *config.Settings) error {
+	if settings.BackupFilename == "" {
+		return fmt.Errorf("BACKUP_FILENAME is required for download")
+	}
+	
+	body, err := backend.DownloadStream(settings, settings.BackupFilename)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	
+	// Create local file
+	file, err := os.Create(settings.RestoreTmpFilename)
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+	defer file.Close()
+	
+	// Copy downloaded content to local file
+	if _, err := io.Copy(file, body); err != nil {
+		return fmt.Errorf("failed to write downloaded content: %w", err)
+	}
+	
+	return file.Close()
+}
+
+// closeFuncReader releases a connection once the file read from it is closed
+type closeFuncReader struct {
+	io.ReadCloser
+	closeFn func()
+}
+
+func (c *closeFuncReader) Close() error {
+	err := c.ReadCloser.Close()
+	c.closeFn()
+	return err
+}
+
 // EnsureMaxRetention ensures the maximum retention policy is enforced
 func EnsureMaxRetention(settings *config.Settings) error {
-	if settings.BackupMaxRetention <= 0 {
+	if !retentionEnabled(settings) {
 		logger.Debug("Retention policy disabled, skipping cleanup")
 		return nil
 	}
 	
-	logger.Infof("Enforcing retention policy (max %d backups)", settings.BackupMaxRetention)
+	logger.Infof("Enforcing retention policy (%s)", describeRetention(settings))
+	if settings.BackupRetentionDryRun {
+		logger.Info("Dry run enabled, no backup will be deleted")
+	}
 	
 	backend, err := GetBackend(settings.BackupMethod)
 	if err != nil {
 		return err
 	}
 	
-	if err := backend.ValidateConfig(); err != nil {
+	if err := backend.ValidateConfig(settings); err != nil {
 		return fmt.Errorf("storage configuration validation failed: %w", err)
 	}
 	
@@ -0,0 +1,225 @@
+package verify
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/database"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+	"github.com/Frantche/gitea-backup-restore-process/internal/signing"
+	"github.com/Frantche/gitea-backup-restore-process/internal/storage"
+	"github.com/Frantche/gitea-backup-restore-process/pkg/logger"
+)
+
+// maxSignatureSize bounds the signature file read from remote storage
+const maxSignatureSize = 4096
+
+// Report is the result of checking a backup archive
+type Report struct {
+	Backup    string
+	Format    string
+	Signature string
+	DBType    string
+	DumpFile  string
+	Manifest  *manifest.Manifest
+	Files     int
+	Problems  []string
+}
+
+// OK reports whether the backup passed every check
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// String formats the report for humans
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Backup:     %s\n", r.Backup)
+	fmt.Fprintf(&b, "Format:     %s\n", r.Format)
+	fmt.Fprintf(&b, "Signature:  %s\n", r.Signature)
+	if r.Manifest != nil {
+		fmt.Fprintf(&b, "Created:    %s on %s by %s\n", r.Manifest.CreatedAt.Format(time.RFC3339), r.Manifest.Hostname, r.Manifest.ToolVersion)
+		fmt.Fprintf(&b, "Manifest:   %d files listed\n", len(r.Manifest.Files))
+	} else {
+		fmt.Fprintf(&b, "Manifest:   none, only the archive checksums were checked\n")
+	}
+	fmt.Fprintf(&b, "Database:   %s (%s)\n", r.DBType, r.DumpFile)
+	fmt.Fprintf(&b, "Files read: %d\n", r.Files)
+	if r.OK() {
+		fmt.Fprintf(&b, "Result:     OK\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Result:     FAILED, %d problems\n", len(r.Problems))
+	for _, problem := range r.Problems {
+		fmt.Fprintf(&b, "  - %s\n", strings.ReplaceAll(problem, "\n", "\n    "))
+	}
+	return b.String()
+}
+
+// Signature checks the downloaded archive, RestoreTmpFilename, against the
+// detached signature of BackupFilename when a public key is configured. It
+// returns false if no public key is configured.
+func Signature(settings *config.Settings) (bool, error) {
+	if settings.SigningPublicKeyFile == "" {
+		logger.Debug("No signing public key configured, skipping signature verification")
+		return false, nil
+	}
+
+	public, err := signing.ReadPublicKey(settings.SigningPublicKeyFile)
+	if err != nil {
+		return false, err
+	}
+
+	name := settings.BackupFilename + signing.Suffix
+	body, err := storage.DownloadStream(settings, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to download signature %s: %w", name, err)
+	}
+	defer body.Close()
+
+	sig, err := io.ReadAll(io.LimitReader(body, maxSignatureSize))
+	if err != nil {
+		return false, fmt.Errorf("failed to download signature %s: %w", name, err)
+	}
+
+	if err := signing.VerifyFile(settings.RestoreTmpFilename, sig, public, settings.BackupFilename); err != nil {
+		return false, err
+	}
+
+	logger.Info("Backup signature verified successfully")
+	return true, nil
+}
+
+// Archive checks the decrypted archive at path without extracting it: every
+// entry is read through the archive checksums and compared with the
+// manifest, if any, and the database dump must be present and pass its
+// adapter's checks. dbType may be empty to use the manifest's. Problems with
+// the backup are listed in the report; an error is only returned if the
+// archive cannot be read at all.
+func Archive(path, dbType string) (*Report, error) {
+	report := &Report{DBType: dbType}
+
+	format, err := compression.DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	report.Format = format
+	logger.Infof("Checking %s archive", format)
+
+	// The dump of any database type is checked as it goes by, which type
+	// matters is only known once the manifest is read
+	dumpTypes := make(map[string]string)
+	for _, supported := range database.SupportedTypes {
+		names, err := database.DumpNames(supported)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			dumpTypes[name] = supported
+		}
+	}
+	dumpErrors := make(map[string]error)
+
+	found := make(map[string]manifest.Entry)
+	var manifestData []byte
+	walkErr := compression.WalkArchive(path, func(name string, r io.Reader) error {
+		report.Files++
+		hasher := manifest.NewHasher()
+		entry := &readErrRecorder{r: r}
+		tee := io.TeeReader(entry, hasher)
+
+		switch {
+		case name == manifest.FileName:
+			data, err := io.ReadAll(tee)
+			if err != nil {
+				return err
+			}
+			manifestData = data
+		case dumpTypes[name] != "":
+			dumpErrors[name] = database.CheckDump(dumpTypes[name], tee)
+		}
+
+		// Hash whatever was left unread. Archive checksum errors surface
+		// here even if the dump check swallowed them.
+		if _, err := io.Copy(io.Discard, tee); err != nil {
+			return err
+		}
+		if entry.err != nil {
+			return entry.err
+		}
+		found[name] = manifest.Entry{Name: name, Size: hasher.Size(), SHA256: hex.EncodeToString(hasher.Sum())}
+		return nil
+	})
+	if walkErr != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("archive is corrupted: %v", walkErr))
+	}
+
+	if manifestData != nil {
+		m, err := manifest.Parse(manifestData)
+		if err != nil {
+			report.Problems = append(report.Problems, err.Error())
+		} else {
+			report.Manifest = m
+		}
+	}
+
+	if report.Manifest != nil {
+		if report.DBType == "" {
+			report.DBType = report.Manifest.DBType
+		} else if report.Manifest.DBType != report.DBType {
+			report.Problems = append(report.Problems, fmt.Sprintf("backup contains a %s database but Gitea is configured for %s", report.Manifest.DBType, report.DBType))
+		}
+		if walkErr == nil {
+			if err := report.Manifest.VerifyEntries(found); err != nil {
+				report.Problems = append(report.Problems, err.Error())
+			}
+		}
+	}
+
+	if report.DBType == "" {
+		report.Problems = append(report.Problems, "cannot tell the database type: the backup has no manifest and no Gitea configuration was found")
+		return report, nil
+	}
+	names, err := database.DumpNames(report.DBType)
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+		return report, nil
+	}
+	// The dump is in one of the formats of the database type, the first one
+	// when it is missing
+	report.DumpFile = names[0]
+	for _, name := range names {
+		if _, ok := dumpErrors[name]; ok {
+			report.DumpFile = name
+			break
+		}
+	}
+	if dumpErr, ok := dumpErrors[report.DumpFile]; !ok {
+		if walkErr == nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s: database dump is missing", report.DumpFile))
+		}
+	} else if dumpErr != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("%s: %v", report.DumpFile, dumpErr))
+	}
+
+	return report, nil
+}
+
+// readErrRecorder remembers the first read error other than io.EOF
+type readErrRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (e *readErrRecorder) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF && e.err == nil {
+		e.err = err
+	}
+	return n, err
+}
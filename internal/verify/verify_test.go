@@ -0,0 +1,231 @@
+package verify
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Frantche/gitea-backup-restore-process/internal/compression"
+	"github.com/Frantche/gitea-backup-restore-process/internal/config"
+	"github.com/Frantche/gitea-backup-restore-process/internal/manifest"
+	"github.com/Frantche/gitea-backup-restore-process/internal/signing"
+)
+
+const mysqlDump = "-- MySQL dump 10.13\nCREATE TABLE t;\n-- Dump completed on 2024-01-01\n"
+
+// createArchive archives files with a manifest, if m is not nil, and returns
+// the archive path
+func createArchive(t *testing.T, format string, files map[string]string, m *manifest.Manifest) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	settings := &config.Settings{
+		BackupArchiveFormat: format,
+		BackupTmpFolder:     filepath.Join(tmpDir, "backup"),
+		BackupTmpFilename:   filepath.Join(tmpDir, "backup.archive"),
+	}
+	for name, content := range files {
+		path := filepath.Join(settings.BackupTmpFolder, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	if err := compression.CreateZip(settings, m); err != nil {
+		t.Fatalf("CreateZip failed: %v", err)
+	}
+	return settings.BackupTmpFilename
+}
+
+func TestArchive_OK(t *testing.T) {
+	for _, format := range config.ArchiveFormats {
+		t.Run(format, func(t *testing.T) {
+			path := createArchive(t, format, map[string]string{
+				"dump.mysql.sql": mysqlDump,
+				"repo/a/HEAD":    "ref: refs/heads/main",
+			}, manifest.New("mysql", "dump.mysql.sql"))
+
+			report, err := Archive(path, "")
+			if err != nil {
+				t.Fatalf("Archive failed: %v", err)
+			}
+			if !report.OK() {
+				t.Errorf("Expected backup to pass verification, got:\n%s", report)
+			}
+			if report.DBType != "mysql" || report.DumpFile != "dump.mysql.sql" || report.Files != 3 {
+				t.Errorf("Unexpected report:\n%s", report)
+			}
+		})
+	}
+}
+
+func TestArchive_PostgresDirectoryFormat(t *testing.T) {
+	path := createArchive(t, config.ArchiveFormatZip, map[string]string{
+		"dump.postgres/toc.dat":  "PGDMP\x01\x0f\x00",
+		"dump.postgres/3001.dat": "1\tgitea\n",
+		"repo/a/HEAD":            "ref: refs/heads/main",
+	}, nil)
+
+	report, err := Archive(path, "postgres")
+	if err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("Expected backup to pass verification, got:\n%s", report)
+	}
+	if report.DumpFile != "dump.postgres/toc.dat" {
+		t.Errorf("Expected the table of contents to be checked, got %s", report.DumpFile)
+	}
+}
+
+func TestArchive_Problems(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		manifest *manifest.Manifest
+		dbType   string
+		want     string
+	}{
+		{
+			name:     "truncated dump",
+			files:    map[string]string{"dump.mysql.sql": "-- MySQL dump 10.13\nINSERT INTO"},
+			manifest: manifest.New("mysql", "dump.mysql.sql"),
+			want:     "dump is incomplete",
+		},
+		{
+			name:     "corrupted custom format dump",
+			files:    map[string]string{"dump.postgres.dump": "not a dump"},
+			manifest: manifest.New("postgres", "dump.postgres.dump"),
+			want:     "dump.postgres.dump: dump does not start",
+		},
+		{
+			name:     "missing dump",
+			files:    map[string]string{"repo/a/HEAD": "ref: refs/heads/main"},
+			manifest: nil,
+			dbType:   "postgres",
+			want:     "database dump is missing",
+		},
+		{
+			name:     "database type mismatch",
+			files:    map[string]string{"dump.mysql.sql": mysqlDump},
+			manifest: manifest.New("mysql", "dump.mysql.sql"),
+			dbType:   "postgres",
+			want:     "Gitea is configured for postgres",
+		},
+		{
+			name:     "unknown database type",
+			files:    map[string]string{"dump.mysql.sql": mysqlDump},
+			manifest: nil,
+			want:     "cannot tell the database type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := createArchive(t, config.ArchiveFormatZip, tt.files, tt.manifest)
+
+			report, err := Archive(path, tt.dbType)
+			if err != nil {
+				t.Fatalf("Archive failed: %v", err)
+			}
+			if report.OK() || !strings.Contains(report.String(), tt.want) {
+				t.Errorf("Expected a problem containing %q, got:\n%s", tt.want, report)
+			}
+		})
+	}
+}
+
+func TestArchive_ManifestMismatch(t *testing.T) {
+	m := manifest.New("mysql", "dump.mysql.sql")
+	m.Add("repo/a/HEAD", 3, []byte("not the checksum"))
+	path := createArchive(t, config.ArchiveFormatTarZst, map[string]string{
+		"dump.mysql.sql": mysqlDump,
+	}, m)
+
+	report, err := Archive(path, "mysql")
+	if err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	if report.OK() || !strings.Contains(report.String(), "repo/a/HEAD: missing") {
+		t.Errorf("Expected manifest mismatch, got:\n%s", report)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	tmpDir := t.TempDir()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	publicFile := filepath.Join(tmpDir, "backup.pub")
+	if err := os.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+
+	storeDir := filepath.Join(tmpDir, "store")
+	if err := os.MkdirAll(storeDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	t.Setenv("BACKUP_LOCAL_DIR", storeDir)
+
+	archive := filepath.Join(tmpDir, "restore.zip")
+	if err := os.WriteFile(archive, []byte("archive content"), 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	sig, err := signing.SignFile(archive, "backup.zip", private)
+	if err != nil {
+		t.Fatalf("SignFile failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(storeDir, "backup.zip.sig"), sig, 0644); err != nil {
+		t.Fatalf("Failed to write signature: %v", err)
+	}
+
+	settings := &config.Settings{
+		BackupMethod:         "local",
+		BackupFilename:       "backup.zip",
+		RestoreTmpFilename:   archive,
+		SigningPublicKeyFile: publicFile,
+	}
+
+	if verified, err := Signature(settings); err != nil || !verified {
+		t.Fatalf("Expected signature to verify, got %v, %v", verified, err)
+	}
+
+	// The archive and its signature copied over another backup
+	if err := os.WriteFile(filepath.Join(storeDir, "newer.zip.sig"), sig, 0644); err != nil {
+		t.Fatalf("Failed to write signature: %v", err)
+	}
+	settings.BackupFilename = "newer.zip"
+	if _, err := Signature(settings); !errors.Is(err, signing.ErrNameMismatch) {
+		t.Errorf("Expected ErrNameMismatch for a renamed archive, got %v", err)
+	}
+	settings.BackupFilename = "backup.zip"
+
+	if err := os.WriteFile(archive, []byte("tampered content"), 0644); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	if _, err := Signature(settings); err == nil {
+		t.Error("Expected error for a tampered archive, got nil")
+	}
+
+	settings.BackupFilename = "unsigned.zip"
+	if _, err := Signature(settings); err == nil {
+		t.Error("Expected error for a missing signature, got nil")
+	}
+
+	settings.SigningPublicKeyFile = ""
+	if verified, err := Signature(settings); err != nil || verified {
+		t.Errorf("Expected signature check to be skipped, got %v, %v", verified, err)
+	}
+}
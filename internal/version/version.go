@@ -0,0 +1,19 @@
+package version
+
+import "runtime/debug"
+
+// Version is the version of the backup tool. It is set at build time with
+// -ldflags "-X github.com/Frantche/gitea-backup-restore-process/internal/version.Version=v1.2.3"
+var Version = "dev"
+
+// String returns the tool version, falling back to the module version
+// recorded by "go install" when Version was not set at build time
+func String() string {
+	if Version != "dev" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return Version
+}
@@ -0,0 +1,164 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures a Handler
+type Options struct {
+	// Level is the minimum level of the records written, info if nil
+	Level slog.Leveler
+	// Format is FormatText or FormatJSON
+	Format string
+}
+
+// Handler is a slog.Handler writing debug and info records to one writer
+// and warnings and errors to another
+type Handler struct {
+	out    slog.Handler
+	errOut slog.Handler
+}
+
+// NewHandler returns a handler writing debug and info records to out and
+// warnings and errors to errOut
+func NewHandler(out, errOut io.Writer, opts *Options) *Handler {
+	if opts == nil {
+		opts = &Options{}
+	}
+	level := opts.Level
+	if level == nil {
+		level = slog.LevelInfo
+	}
+
+	newHandler := func(w io.Writer) slog.Handler {
+		if opts.Format == FormatJSON {
+			return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: jsonDuration})
+		}
+		return &textHandler{w: w, mu: &sync.Mutex{}, level: level}
+	}
+	return &Handler{out: newHandler(out), errOut: newHandler(errOut)}
+}
+
+func (h *Handler) handler(level slog.Level) slog.Handler {
+	if level >= slog.LevelWarn {
+		return h.errOut
+	}
+	return h.out
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler(level).Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler(r.Level).Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{out: h.out.WithAttrs(attrs), errOut: h.errOut.WithAttrs(attrs)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{out: h.out.WithGroup(name), errOut: h.errOut.WithGroup(name)}
+}
+
+// jsonDuration writes durations as seconds rather than nanoseconds
+func jsonDuration(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindDuration {
+		return slog.Float64(a.Key, a.Value.Duration().Seconds())
+	}
+	return a
+}
+
+// textHandler writes records as "LEVEL: date time message key=value ..."
+type textHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	level slog.Leveler
+	// attrs holds the attributes added by WithAttrs, already formatted
+	attrs  string
+	prefix string
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: ", r.Level)
+	if !r.Time.IsZero() {
+		buf.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	}
+	buf.WriteString(r.Message)
+	buf.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&buf, h.prefix, a)
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var buf bytes.Buffer
+	for _, a := range attrs {
+		appendAttr(&buf, h.prefix, a)
+	}
+	clone := *h
+	clone.attrs += buf.String()
+	return &clone
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix += name + "."
+	return &clone
+}
+
+// appendAttr writes " key=value", flattening groups into dotted keys
+func appendAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix += a.Key + "."
+		}
+		for _, member := range a.Value.Group() {
+			appendAttr(buf, groupPrefix, member)
+		}
+		return
+	}
+
+	var value string
+	switch a.Value.Kind() {
+	case slog.KindDuration:
+		value = a.Value.Duration().Round(time.Millisecond).String()
+	case slog.KindTime:
+		value = a.Value.Time().Format(time.RFC3339)
+	default:
+		value = a.Value.String()
+	}
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+		value = strconv.Quote(value)
+	}
+	fmt.Fprintf(buf, " %s%s=%s", prefix, a.Key, value)
+}
@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// capture sends the package logs to buffers for the duration of the test
+func capture(t *testing.T, opts *Options) (out, errOut *bytes.Buffer) {
+	t.Helper()
+	previous := Default()
+	t.Cleanup(func() { defaultLogger.Store(previous) })
+
+	out, errOut = &bytes.Buffer{}, &bytes.Buffer{}
+	SetHandler(NewHandler(out, errOut, opts))
+	return out, errOut
+}
+
+func TestHandler_LevelFiltering(t *testing.T) {
+	out, errOut := capture(t, &Options{Level: slog.LevelInfo, Format: FormatText})
+
+	Debugf("hidden %d", 1)
+	Infof("shown %d", 2)
+	Warn("careful")
+	Errorf("broken %s", "pipe")
+
+	if strings.Contains(out.String(), "hidden") {
+		t.Errorf("Expected debug records to be filtered out:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "INFO: ") || !strings.Contains(out.String(), "shown 2\n") {
+		t.Errorf("Expected the info record on out:\n%s", out.String())
+	}
+	if !strings.Contains(errOut.String(), "WARN: ") || !strings.Contains(errOut.String(), "ERROR: ") || !strings.Contains(errOut.String(), "broken pipe") {
+		t.Errorf("Expected warnings and errors on errOut:\n%s", errOut.String())
+	}
+}
+
+func TestHandler_TextAttributes(t *testing.T) {
+	out, _ := capture(t, &Options{Level: slog.LevelDebug})
+
+	With("backend", "s3").WithGroup("upload").Info("Upload completed", "file", "gitea backup.zip", "parts", 3)
+
+	line := out.String()
+	for _, want := range []string{"Upload completed", "backend=s3", `upload.file="gitea backup.zip"`, "upload.parts=3"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("Expected %q in %q", want, line)
+		}
+	}
+}
+
+func TestHandler_JSONStage(t *testing.T) {
+	out, errOut := capture(t, &Options{Level: slog.LevelInfo, Format: FormatJSON})
+
+	Stage("upload")(nil)
+	Stage("database_backup")(errors.New("mysqldump: access denied"))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 records on out, got %d:\n%s", len(lines), out.String())
+	}
+	var completed map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &completed); err != nil {
+		t.Fatalf("Invalid JSON record %q: %v", lines[1], err)
+	}
+	if completed["stage"] != "upload" || completed["msg"] != "Stage completed" || completed["level"] != "INFO" {
+		t.Errorf("Unexpected record: %v", completed)
+	}
+	if _, ok := completed["duration"].(float64); !ok {
+		t.Errorf("Expected the duration in seconds, got %v", completed["duration"])
+	}
+
+	// The error is left to the caller, so that it is reported once
+	var failed map[string]any
+	if err := json.Unmarshal([]byte(lines[3]), &failed); err != nil {
+		t.Fatalf("Invalid JSON record %q: %v", lines[3], err)
+	}
+	if failed["stage"] != "database_backup" || failed["msg"] != "Stage failed" {
+		t.Errorf("Unexpected record: %v", failed)
+	}
+	if _, ok := failed["error"]; ok {
+		t.Errorf("Expected no error in the stage record, got %v", failed)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("Expected nothing on errOut, got:\n%s", errOut.String())
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	previous := Default()
+	t.Cleanup(func() { defaultLogger.Store(previous) })
+
+	if err := Configure("debug", FormatJSON); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := Configure("verbose", ""); err == nil {
+		t.Error("Expected error for an invalid level, got nil")
+	}
+	if err := Configure("info", "xml"); err == nil {
+		t.Error("Expected error for an invalid format, got nil")
+	}
+}
@@ -1,42 +1,158 @@
+// Package logger writes the logs of the backup and restore tools. Records go
+// through a log/slog handler, in plain text or one JSON object per line, and
+// are filtered by level. Every record goes to stderr, leaving stdout to the
+// output of the commands, which may be read by other programs.
 package logger
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-var (
-	InfoLogger  *log.Logger
-	ErrorLogger *log.Logger
-	DebugLogger *log.Logger
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
 )
 
+// Environment variables read at startup, before the settings are loaded
+const (
+	LevelEnv  = "LOG_LEVEL"
+	FormatEnv = "LOG_FORMAT"
+)
+
+var defaultLogger atomic.Pointer[slog.Logger]
+
 func init() {
-	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-	DebugLogger = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
+	level, err := ParseLevel(os.Getenv(LevelEnv))
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	format := os.Getenv(FormatEnv)
+	if format != FormatJSON {
+		format = FormatText
+	}
+	SetHandler(NewHandler(os.Stderr, os.Stderr, &Options{Level: level, Format: format}))
+}
+
+// ParseLevel parses a level name: debug, info, warn or error. An empty name
+// selects info.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("invalid log level '%s', expected debug, info, warn or error", name)
+	}
+}
+
+// Configure replaces the default handler with one writing to stderr at the
+// given level and format
+func Configure(level, format string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "":
+		format = FormatText
+	case FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("invalid log format '%s', expected %s or %s", format, FormatText, FormatJSON)
+	}
+	SetHandler(NewHandler(os.Stderr, os.Stderr, &Options{Level: lvl, Format: format}))
+	return nil
+}
+
+// SetHandler sends every log record to h
+func SetHandler(h slog.Handler) {
+	defaultLogger.Store(slog.New(h))
+}
+
+// Default returns the logger the package functions write to
+func Default() *slog.Logger {
+	return defaultLogger.Load()
+}
+
+// With returns a logger adding args, as key-value pairs or slog.Attr, to
+// every record
+func With(args ...any) *slog.Logger {
+	return Default().With(args...)
+}
+
+// Stage logs the start of a stage of the backup or restore and returns a
+// function to call when it ends, which logs its duration and whether it
+// failed. The error itself is left to the caller, which reports it once with
+// its context.
+func Stage(name string) func(err error) {
+	l := With("stage", name)
+	l.Info("Stage started")
+	start := time.Now()
+	return func(err error) {
+		duration := time.Since(start)
+		if err != nil {
+			l.Info("Stage failed", "duration", duration)
+			return
+		}
+		l.Info("Stage completed", "duration", duration)
+	}
+}
+
+func logf(level slog.Level, format string, v ...interface{}) {
+	l := Default()
+	if !l.Enabled(context.Background(), level) {
+		return
+	}
+	l.Log(context.Background(), level, fmt.Sprintf(format, v...))
+}
+
+func logln(level slog.Level, v ...interface{}) {
+	l := Default()
+	if !l.Enabled(context.Background(), level) {
+		return
+	}
+	l.Log(context.Background(), level, strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
 }
 
 func Info(v ...interface{}) {
-	InfoLogger.Println(v...)
+	logln(slog.LevelInfo, v...)
+}
+
+func Warn(v ...interface{}) {
+	logln(slog.LevelWarn, v...)
 }
 
 func Error(v ...interface{}) {
-	ErrorLogger.Println(v...)
+	logln(slog.LevelError, v...)
 }
 
 func Debug(v ...interface{}) {
-	DebugLogger.Println(v...)
+	logln(slog.LevelDebug, v...)
 }
 
 func Infof(format string, v ...interface{}) {
-	InfoLogger.Printf(format, v...)
+	logf(slog.LevelInfo, format, v...)
+}
+
+func Warnf(format string, v ...interface{}) {
+	logf(slog.LevelWarn, format, v...)
 }
 
 func Errorf(format string, v ...interface{}) {
-	ErrorLogger.Printf(format, v...)
+	logf(slog.LevelError, format, v...)
 }
 
 func Debugf(format string, v ...interface{}) {
-	DebugLogger.Printf(format, v...)
-}
\ No newline at end of file
+	logf(slog.LevelDebug, format, v...)
+}
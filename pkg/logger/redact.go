@@ -0,0 +1,32 @@
+package logger
+
+import "regexp"
+
+// Redacted stands in for a secret in logs
+const Redacted = "[REDACTED]"
+
+// Redact returns Redacted for a non-empty secret and an empty string
+// otherwise, so that logs still tell whether a secret is set
+func Redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return Redacted
+}
+
+var (
+	// secretHeaderPattern matches the headers of an HTTP dump that carry
+	// credentials or request signatures
+	secretHeaderPattern = regexp.MustCompile(`(?im)^((?:Authorization|Proxy-Authorization|Cookie|Set-Cookie|X-Amz-Security-Token|X-Amz-Server-Side-Encryption-Customer-Key(?:-Md5)?):[ \t]*)[^\r\n]*`)
+
+	// secretQueryPattern matches the signature parameters of presigned URLs
+	secretQueryPattern = regexp.MustCompile(`(?i)((?:X-Amz-Signature|X-Amz-Credential|X-Amz-Security-Token|Signature|AWSAccessKeyId)=)[^&\s]*`)
+)
+
+// RedactHTTP masks the credentials of a dumped HTTP request or response: the
+// authorization, cookie and security token headers and the signature
+// parameters of presigned URLs
+func RedactHTTP(dump string) string {
+	dump = secretHeaderPattern.ReplaceAllString(dump, "${1}"+Redacted)
+	return secretQueryPattern.ReplaceAllString(dump, "${1}"+Redacted)
+}
@@ -0,0 +1,36 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	if got := Redact(""); got != "" {
+		t.Errorf("Expected an empty secret to stay empty, got %q", got)
+	}
+	if got := Redact("hunter2"); got != Redacted {
+		t.Errorf("Expected %q, got %q", Redacted, got)
+	}
+}
+
+func TestRedactHTTP(t *testing.T) {
+	dump := "PUT /bucket/gitea-backup.zip?x-id=PutObject&X-Amz-Signature=abc123&X-Amz-Credential=AKIAEXAMPLE%2F20240101 HTTP/1.1\r\n" +
+		"Host: s3.example.com\r\n" +
+		"Authorization: AWS4-HMAC-SHA256 Credential=AKIAEXAMPLE/20240101/us-east-1/s3/aws4_request, SignedHeaders=host, Signature=deadbeef\r\n" +
+		"X-Amz-Security-Token: FwoGZXIvYXdzEXAMPLE\r\n" +
+		"X-Amz-Content-Sha256: UNSIGNED-PAYLOAD\r\n" +
+		"\r\n"
+
+	got := RedactHTTP(dump)
+	for _, secret := range []string{"abc123", "AKIAEXAMPLE", "deadbeef", "FwoGZXIvYXdzEXAMPLE"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("Expected %q to be redacted:\n%s", secret, got)
+		}
+	}
+	for _, kept := range []string{"Host: s3.example.com", "x-id=PutObject", "X-Amz-Content-Sha256: UNSIGNED-PAYLOAD", "Authorization: " + Redacted} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("Expected %q to be kept:\n%s", kept, got)
+		}
+	}
+}